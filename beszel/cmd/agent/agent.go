@@ -21,12 +21,17 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Yapılandırma dosyasını yükle (ortam değişkenleri dosyadaki değerleri geçersiz kılar)
+	if err := agent.LoadConfig(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Anahtarı KEY ortam değişkeninden almaya çalış.
-	pubKey := []byte(os.Getenv("KEY"))
+	pubKey := []byte(agent.GetEnv("KEY"))
 
 	// Eğer KEY ayarlanmamışsa, anahtarı KEY_FILE ile belirtilen dosyadan okumaya çalış.
 	if len(pubKey) == 0 {
-		keyFile, varMi := os.LookupEnv("KEY_FILE")
+		keyFile, varMi := agent.LookupEnv("KEY_FILE")
 		if !varMi {
 			log.Fatal("KEY veya KEY_FILE ortam değişkenini ayarlamalısınız")
 		}
@@ -38,7 +43,7 @@ func main() {
 	}
 
 	addr := ":45876"
-	if portEnvVar, varMi := os.LookupEnv("PORT"); varMi {
+	if portEnvVar, varMi := agent.LookupEnv("PORT"); varMi {
 		// "127.0.0.1:45876" şeklinde bir adres geçilmesine izin ver
 		if !strings.Contains(portEnvVar, ":") {
 			portEnvVar = ":" + portEnvVar
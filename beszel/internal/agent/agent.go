@@ -8,11 +8,14 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/shirou/gopsutil/v4/common"
 )
 
 type Agent struct {
+	sync.Mutex                                  // Yapılandırma yeniden yüklenirken istatistik toplamayı engeller
 	debug            bool                       // LOG_LEVEL debug olarak ayarlandığında true
 	zfs              bool                       // Sistem arcstats'e sahip olduğunda true
 	memCalc          string                     // Bellek hesaplama formülü
@@ -25,34 +28,162 @@ type Agent struct {
 	sensorsWhitelist map[string]struct{}        // İzlenecek sensörlerin listesi
 	systemInfo       system.Info                // Ana sistem bilgisi
 	gpuManager       *GPUManager                // GPU verilerini yönetir
+	checkManager     *checkManager              // Servis kontrollerini yönetir
+	certManager      *certManager               // TLS sertifika kontrollerini yönetir
+	pluginManager    *pluginManager             // Özel metrik eklentilerini çalıştırır
+	promManager      *prometheusManager         // Yerel Prometheus dışa aktarıcılarını toplar
+	statsdServer     *statsdServer              // StatsD metriklerini toplar
+	logWatcher       *logWatcher                // Günlük dosyalarındaki desen eşleşmelerini sayar
+	eventCollector   *eventCollector            // Çekirdek ve journal hata olaylarını toplar
+	updateChecker    *updateChecker             // Bekleyen paket güncellemelerini kontrol eder
+	inventoryUpdated time.Time                  // Envanterin son güncellenme zamanı
+	listeningPorts   bool                       // Dinlenen portlar raporlandığında true
+	sessionTracker   *sessionTracker            // Oturumları ve başarısız SSH girişlerini izler
+	libvirtManager   *libvirtManager            // libvirt sanal makine istatistiklerini toplar
+	lxcManager       *lxcManager                // LXC konteyner istatistiklerini cgroup'lardan toplar
+	wireguardManager *wireguardManager          // WireGuard arayüzlerini ve eşlerini izler
+	sampleBuffer     *sampleBuffer              // Hub erişilemezken alınan örnekleri saklar
+	lastPoll         time.Time                  // Hub'ın istatistikleri son istediği zaman
+	pollInterval     time.Duration              // Hub'ın istatistikleri isteme aralığı
+	rateSampler      *rateSampler               // Yoklamalar arasındaki en düşük ve en yüksek değerleri izler
 }
 
 func NewAgent() *Agent {
 	return &Agent{
 		sensorsContext: context.Background(),
-		memCalc:        os.Getenv("MEM_CALC"),
 		fsStats:        make(map[string]*system.FsStats),
 	}
 }
 
 func (a *Agent) Run(pubKey []byte, addr string) {
-	// LOG_LEVEL ortam değişkeni tarafından belirlenen bir günlük seviyesi ile slog'u ayarlayın
-	if logLevelStr, exists := os.LookupEnv("LOG_LEVEL"); exists {
-		switch strings.ToLower(logLevelStr) {
-		case "debug":
-			a.debug = true
-			slog.SetLogLoggerLevel(slog.LevelDebug)
-		case "warn":
-			slog.SetLogLoggerLevel(slog.LevelWarn)
-		case "error":
-			slog.SetLogLoggerLevel(slog.LevelError)
+	// Yapılandırmaya bağlı ayarları ve toplayıcıları uygulayın
+	a.applyConfig()
+
+	slog.Debug(beszel.Version)
+
+	// Sistem bilgilerini başlatın
+	a.initializeSystemInfo()
+
+	// GPU yöneticisini başlatın
+	if gm, err := NewGPUManager(); err != nil {
+		slog.Debug("GPU", "err", err)
+	} else {
+		a.gpuManager = gm
+	}
+
+	// StatsD dinleyicisini başlatın
+	if statsdAddr, exists := LookupEnv("STATSD_ADDR"); exists {
+		if server, err := newStatsdServer(statsdAddr); err != nil {
+			slog.Error("STATSD_ADDR", "err", err)
+		} else {
+			a.statsdServer = server
 		}
 	}
 
-	slog.Debug(beszel.Version)
+	// Günlük izleyicisini başlatın
+	if logWatch, exists := LookupEnv("LOG_WATCH"); exists {
+		if lw, err := newLogWatcher(logWatch); err != nil {
+			slog.Error("LOG_WATCH", "err", err)
+		} else {
+			a.logWatcher = lw
+		}
+	}
+
+	// Olay toplayıcısını başlatın (EVENTS=true ile etkinleştirilir)
+	if GetEnv("EVENTS") == "true" {
+		a.eventCollector = newEventCollector()
+	}
+
+	// Paket güncelleme denetleyicisini başlatın (UPDATES=false ile devre dışı bırakılabilir)
+	if GetEnv("UPDATES") != "false" {
+		if updateChecker, err := newUpdateChecker(); err != nil {
+			slog.Error("UPDATES_INTERVAL", "err", err)
+		} else {
+			a.updateChecker = updateChecker
+		}
+	}
+
+	// Oturum izleyicisini başlatın (SESSIONS=false ile devre dışı bırakılabilir)
+	if GetEnv("SESSIONS") != "false" {
+		a.sessionTracker = newSessionTracker()
+	}
+
+	// Hub erişilemezken örnekleri arabelleğe alın (BUFFER=false ile devre dışı bırakılabilir)
+	if GetEnv("BUFFER") != "false" {
+		if sb, err := newSampleBuffer(); err != nil {
+			slog.Error("BUFFER_SIZE", "err", err)
+		} else {
+			a.sampleBuffer = sb
+			go a.bufferSamples()
+		}
+	}
+
+	// Yoklamalar arasında örnek alarak en düşük ve en yüksek değerleri izleyin
+	// (SAMPLING=false ile devre dışı bırakılabilir)
+	if GetEnv("SAMPLING") != "false" {
+		if rs, err := newRateSampler(); err != nil {
+			slog.Error("SAMPLE_INTERVAL", "err", err)
+		} else {
+			a.rateSampler = rs
+			go a.sampleRates()
+		}
+	}
+
+	// Eğer debug modundaysa, istatistikleri yazdırın
+	if a.debug {
+		slog.Debug("İstatistikler", "data", a.gatherStats())
+	}
+
+	keys, err := newAuthorizedKeys(pubKey)
+	if err != nil {
+		slog.Error("KEY", "err", err)
+		os.Exit(1)
+	}
+	server := a.newServer(keys, addr)
+
+	// SIGHUP alındığında yapılandırmayı ve anahtarları yeniden yükleyin
+	go a.handleReloads(keys)
+
+	// HUB_URL ayarlanmışsa hub'a bağlanın; PORT da ayarlanmadıysa gelen bağlantıları dinlemeyin
+	if hubUrl, exists := LookupEnv("HUB_URL"); exists {
+		token, exists := LookupEnv("TOKEN")
+		if !exists || token == "" {
+			slog.Error("TOKEN must be set when using HUB_URL")
+			os.Exit(1)
+		}
+		if _, portSet := LookupEnv("PORT"); !portSet {
+			a.connectToHub(server, hubUrl, token)
+			return
+		}
+		go a.connectToHub(server, hubUrl, token)
+	}
+
+	a.startServer(server)
+}
+
+// Yapılandırmaya bağlı ayarları uygular ve toplayıcıları yeniden oluşturur.
+// Başlangıçta ve yapılandırma SIGHUP ile yeniden yüklendiğinde çalışır.
+func (a *Agent) applyConfig() {
+	// LOG_LEVEL ortam değişkeni tarafından belirlenen bir günlük seviyesi ile slog'u ayarlayın
+	a.debug = false
+	switch strings.ToLower(GetEnv("LOG_LEVEL")) {
+	case "debug":
+		a.debug = true
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	case "warn":
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+	case "error":
+		slog.SetLogLoggerLevel(slog.LevelError)
+	default:
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+	}
+
+	// Bellek hesaplama formülünü ayarlayın
+	a.memCalc = GetEnv("MEM_CALC")
 
 	// Sensörler bağlamını ayarlayın (sensörler için sys konumunu geçersiz kılmaya izin verir)
-	if sysSensors, exists := os.LookupEnv("SYS_SENSORS"); exists {
+	a.sensorsContext = context.Background()
+	if sysSensors, exists := LookupEnv("SYS_SENSORS"); exists {
 		slog.Info("SYS_SENSORS", "path", sysSensors)
 		a.sensorsContext = context.WithValue(a.sensorsContext,
 			common.EnvKey, common.EnvMap{common.HostSysEnvKey: sysSensors},
@@ -60,7 +191,8 @@ func (a *Agent) Run(pubKey []byte, addr string) {
 	}
 
 	// Sensörler beyaz listesini ayarlayın
-	if sensors, exists := os.LookupEnv("SENSORS"); exists {
+	a.sensorsWhitelist = nil
+	if sensors, exists := LookupEnv("SENSORS"); exists {
 		a.sensorsWhitelist = make(map[string]struct{})
 		for _, sensor := range strings.Split(sensors, ",") {
 			if sensor != "" {
@@ -69,25 +201,73 @@ func (a *Agent) Run(pubKey []byte, addr string) {
 		}
 	}
 
-	// Sistem bilgilerini / docker yöneticisini başlatın
-	a.initializeSystemInfo()
+	// Dosya sistemlerini, ağ arayüzlerini ve docker yöneticisini başlatın
 	a.initializeDiskInfo()
 	a.initializeNetIoStats()
+	// Aygıtlar değişmiş olabilir, bu yüzden örneklemeyi yeniden başlatın
+	if a.rateSampler != nil {
+		a.rateSampler.time = time.Time{}
+	}
 	a.dockerManager = newDockerManager(a)
 
-	// GPU yöneticisini başlatın
-	if gm, err := NewGPUManager(); err != nil {
-		slog.Debug("GPU", "err", err)
-	} else {
-		a.gpuManager = gm
+	// Önceki ayarlarla oluşturulan toplayıcıları kaldırın
+	a.checkManager = nil
+	a.certManager = nil
+	a.pluginManager = nil
+	a.promManager = nil
+	a.libvirtManager = nil
+	a.lxcManager = nil
+	a.wireguardManager = nil
+
+	// Servis kontrollerini başlatın
+	if checks, exists := LookupEnv("CHECKS"); exists {
+		if cm, err := newCheckManager(checks); err != nil {
+			slog.Error("CHECKS", "err", err)
+		} else {
+			a.checkManager = cm
+		}
 	}
 
-	// Eğer debug modundaysa, istatistikleri yazdırın
-	if a.debug {
-		slog.Debug("İstatistikler", "data", a.gatherStats())
+	// Sertifika kontrollerini başlatın
+	if certTargets, exists := LookupEnv("CERTS"); exists {
+		a.certManager = newCertManager(certTargets)
+	}
+
+	// Eklenti yöneticisini başlatın
+	if pluginDir, exists := LookupEnv("PLUGIN_DIR"); exists {
+		if pm, err := newPluginManager(pluginDir); err != nil {
+			slog.Error("PLUGIN_DIR", "err", err)
+		} else {
+			a.pluginManager = pm
+		}
+	}
+
+	// Prometheus yöneticisini başlatın
+	if promTargets, exists := LookupEnv("PROMETHEUS"); exists {
+		if pm, err := newPrometheusManager(promTargets); err != nil {
+			slog.Error("PROMETHEUS", "err", err)
+		} else {
+			a.promManager = pm
+		}
+	}
+
+	// Dinlenen portları raporlayın (PORTS=false ile devre dışı bırakılabilir)
+	a.listeningPorts = GetEnv("PORTS") != "false"
+
+	// libvirt yöneticisini başlatın (LIBVIRT=false ile devre dışı bırakılabilir)
+	if GetEnv("LIBVIRT") != "false" {
+		a.libvirtManager = newLibvirtManager()
 	}
 
-	a.startServer(pubKey, addr)
+	// LXC yöneticisini başlatın (LXC=false ile devre dışı bırakılabilir)
+	if GetEnv("LXC") != "false" {
+		a.lxcManager = newLxcManager()
+	}
+
+	// WireGuard yöneticisini başlatın (WIREGUARD=false ile devre dışı bırakılabilir)
+	if GetEnv("WIREGUARD") != "false" {
+		a.wireguardManager = newWireguardManager()
+	}
 }
 
 func (a *Agent) gatherStats() system.CombinedData {
@@ -96,6 +276,14 @@ func (a *Agent) gatherStats() system.CombinedData {
 		Stats: a.getSystemStats(),
 		Info:  a.systemInfo,
 	}
+	// Saat senkronizasyon durumunu ekleyin
+	if status, ok := getClockStatus(); ok {
+		systemData.Stats.ClockOffset = status.offset
+		systemData.Info.ClockSync = "unsynced"
+		if status.synced {
+			systemData.Info.ClockSync = "synced"
+		}
+	}
 	slog.Debug("Sistem istatistikleri", "data", systemData)
 	// Docker istatistiklerini ekleyin
 	if containerStats, err := a.dockerManager.getDockerStats(); err == nil {
@@ -104,6 +292,83 @@ func (a *Agent) gatherStats() system.CombinedData {
 	} else {
 		slog.Debug("Docker istatistikleri alınırken hata oluştu", "err", err)
 	}
+	// LXC konteyner istatistiklerini ekleyin
+	if a.lxcManager != nil {
+		lxcStats := a.lxcManager.getLxcStats()
+		systemData.Containers = append(systemData.Containers, lxcStats...)
+		slog.Debug("LXC istatistikleri", "data", lxcStats)
+	}
+	// Sanal makine istatistiklerini ekleyin
+	if a.libvirtManager != nil {
+		if vmStats, err := a.libvirtManager.getVmStats(); err == nil {
+			systemData.VMs = vmStats
+			slog.Debug("Sanal makine istatistikleri", "data", systemData.VMs)
+		} else {
+			slog.Debug("Sanal makine istatistikleri alınırken hata oluştu", "err", err)
+		}
+	}
+	// WireGuard arayüzlerini ekleyin
+	if a.wireguardManager != nil {
+		if interfaces, err := a.wireguardManager.getInterfaces(); err == nil {
+			systemData.WireGuard = interfaces
+			slog.Debug("WireGuard", "data", systemData.WireGuard)
+		} else {
+			slog.Debug("WireGuard bilgisi alınırken hata oluştu", "err", err)
+		}
+	}
+	// Servis kontrollerini ekleyin
+	if a.checkManager != nil {
+		systemData.Checks = a.checkManager.runChecks()
+		slog.Debug("Servis kontrolleri", "data", systemData.Checks)
+	}
+	// Sertifika bilgilerini ekleyin
+	if a.certManager != nil {
+		systemData.Certificates = a.certManager.getCertificates()
+		slog.Debug("Sertifikalar", "data", systemData.Certificates)
+	}
+	// Eklenti, Prometheus ve StatsD metriklerini ekleyin
+	if a.pluginManager != nil {
+		addCustomMetrics(&systemData.Stats, a.pluginManager.collect())
+	}
+	if a.promManager != nil {
+		addCustomMetrics(&systemData.Stats, a.promManager.collect())
+	}
+	if a.statsdServer != nil {
+		addCustomMetrics(&systemData.Stats, a.statsdServer.collect())
+	}
+	slog.Debug("Özel metrikler", "data", systemData.Stats.Custom)
+	// Günlük eşleşmelerini ekleyin
+	if a.logWatcher != nil {
+		systemData.Stats.LogMatches = a.logWatcher.collect()
+		slog.Debug("Günlük eşleşmeleri", "data", systemData.Stats.LogMatches)
+	}
+	// Sistem olaylarını ekleyin
+	if a.eventCollector != nil {
+		systemData.Events = a.eventCollector.collect()
+		slog.Debug("Sistem olayları", "data", systemData.Events)
+	}
+	// Paket güncelleme durumunu ekleyin (ilk kontrol tamamlanana kadar gönderilmez)
+	if a.updateChecker != nil {
+		if status, checked := a.updateChecker.getStatus(); checked {
+			systemData.Info.Updates = &status.updates
+			systemData.Info.SecurityUpdates = &status.securityUpdates
+			systemData.Info.RebootRequired = status.rebootRequired
+		}
+	}
+	// Dinlenen portları ekleyin
+	if a.listeningPorts {
+		if ports, err := getListeningPorts(); err == nil {
+			systemData.Ports = ports
+		} else {
+			slog.Debug("Dinlenen portlar alınırken hata oluştu", "err", err)
+		}
+	}
+	// Oturumları ve başarısız girişleri ekleyin
+	if a.sessionTracker != nil {
+		systemData.Sessions = a.sessionTracker.getSessions()
+		systemData.Stats.FailedLogins = float64(a.sessionTracker.getFailedLogins())
+		slog.Debug("Oturumlar", "data", systemData.Sessions, "başarısız", systemData.Stats.FailedLogins)
+	}
 	// Ek dosya sistemlerini ekleyin
 	systemData.Stats.ExtraFs = make(map[string]*system.FsStats)
 	for name, stats := range a.fsStats {
@@ -112,5 +377,8 @@ func (a *Agent) gatherStats() system.CombinedData {
 		}
 	}
 	slog.Debug("Ek dosya sistemleri", "data", systemData.Stats.ExtraFs)
+	// Hub tarafından yönetilebilen geçerli ayarları ekleyin
+	systemData.Info.Config = effectiveConfig()
+	systemData.Time = time.Now().UTC()
 	return systemData
 }
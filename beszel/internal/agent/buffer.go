@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// Default number of samples kept while the hub is unreachable (12 hours)
+	defaultBufferSize = 720
+	// Interval between samples taken while the hub is unreachable
+	bufferInterval = time.Minute
+	// Time past the polling interval without a poll after which the hub is
+	// considered unreachable
+	hubTimeout = 30 * time.Second
+)
+
+// Ring buffer of samples taken while the hub is unreachable. The hub requests
+// the samples it missed when it reconnects.
+type sampleBuffer struct {
+	sync.Mutex
+	samples []system.Sample // Ring of samples, oldest at next once full
+	next    int             // Index the next sample is written to
+	full    bool            // True once the ring has wrapped
+	path    string          // BUFFER_FILE the samples are saved to, empty to keep them in memory only
+}
+
+// Creates a buffer holding BUFFER_SIZE samples (default 720, 12 hours). If
+// BUFFER_FILE is set, samples are saved to the file and loaded on start so
+// they survive agent restarts.
+func newSampleBuffer() (*sampleBuffer, error) {
+	size := defaultBufferSize
+	if sizeStr, exists := LookupEnv("BUFFER_SIZE"); exists {
+		var err error
+		if size, err = strconv.Atoi(sizeStr); err != nil {
+			return nil, err
+		}
+		size = max(size, 1)
+	}
+	sb := &sampleBuffer{samples: make([]system.Sample, size), path: GetEnv("BUFFER_FILE")}
+	if sb.path != "" {
+		sb.load()
+	}
+	return sb, nil
+}
+
+// Adds a sample, replacing the oldest one if the buffer is full
+func (sb *sampleBuffer) add(sample system.Sample) {
+	sb.Lock()
+	defer sb.Unlock()
+	sb.samples[sb.next] = sample
+	sb.next = (sb.next + 1) % len(sb.samples)
+	sb.full = sb.full || sb.next == 0
+	sb.save()
+}
+
+// Returns samples taken after the time, oldest first. Older samples are
+// dropped because the hub already has data up to that time.
+func (sb *sampleBuffer) since(t time.Time) []system.Sample {
+	sb.Lock()
+	defer sb.Unlock()
+	var samples []system.Sample
+	for _, sample := range sb.ordered() {
+		if sample.Time.After(t) {
+			samples = append(samples, sample)
+		}
+	}
+	sb.reset(samples)
+	return samples
+}
+
+// Returns the samples in the ring, oldest first
+func (sb *sampleBuffer) ordered() []system.Sample {
+	if !sb.full {
+		return append([]system.Sample(nil), sb.samples[:sb.next]...)
+	}
+	return append(append([]system.Sample(nil), sb.samples[sb.next:]...), sb.samples[:sb.next]...)
+}
+
+// Replaces the contents of the ring with the samples, keeping the newest if there are too many
+func (sb *sampleBuffer) reset(samples []system.Sample) {
+	size := len(sb.samples)
+	if len(samples) > size {
+		samples = samples[len(samples)-size:]
+	}
+	sb.samples = make([]system.Sample, size)
+	sb.next = copy(sb.samples, samples) % size
+	sb.full = len(samples) == size
+	sb.save()
+}
+
+// Loads samples saved by a previous run
+func (sb *sampleBuffer) load() {
+	data, err := os.ReadFile(sb.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Error loading buffer", "path", sb.path, "err", err)
+		}
+		return
+	}
+	var samples []system.Sample
+	if err := cbor.Unmarshal(data, &samples); err != nil {
+		slog.Error("Error loading buffer", "path", sb.path, "err", err)
+		return
+	}
+	sb.reset(samples)
+	slog.Info("Loaded buffer", "path", sb.path, "samples", len(samples))
+}
+
+// Saves the samples to BUFFER_FILE if it's set
+func (sb *sampleBuffer) save() {
+	if sb.path == "" {
+		return
+	}
+	data, err := system.CborEncMode.Marshal(sb.ordered())
+	if err == nil {
+		// write to a temporary file first so a crash doesn't leave a partial buffer
+		if err = os.WriteFile(sb.path+".tmp", data, 0o600); err == nil {
+			err = os.Rename(sb.path+".tmp", sb.path)
+		}
+	}
+	if err != nil {
+		slog.Error("Error saving buffer", "path", sb.path, "err", err)
+	}
+}
+
+// Takes a sample every minute while the hub isn't polling
+func (a *Agent) bufferSamples() {
+	ticker := time.NewTicker(bufferInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.Lock()
+		interval := a.pollInterval
+		if interval == 0 {
+			interval = time.Minute
+		}
+		if time.Since(a.lastPoll) < interval+hubTimeout {
+			a.Unlock()
+			continue
+		}
+		sample := a.takeSample()
+		a.Unlock()
+		a.sampleBuffer.add(sample)
+		slog.Debug("Buffered sample", "time", sample.Time)
+	}
+}
+
+// Gathers system and container stats. Unlike gatherStats, this doesn't collect
+// events, log matches or failed logins, which are kept until the hub polls.
+// Stats are copied because the collectors reuse them.
+func (a *Agent) takeSample() system.Sample {
+	sample := system.Sample{Time: time.Now().UTC(), Stats: a.getSystemStats()}
+	sample.Stats.ExtraFs = make(map[string]*system.FsStats)
+	for name, stats := range a.fsStats {
+		if !stats.Root && stats.DiskTotal > 0 {
+			fsStats := *stats
+			sample.Stats.ExtraFs[name] = &fsStats
+		}
+	}
+	var containers []*container.Stats
+	if containerStats, err := a.dockerManager.getDockerStats(); err == nil {
+		containers = containerStats
+	}
+	if a.lxcManager != nil {
+		containers = append(containers, a.lxcManager.getLxcStats()...)
+	}
+	for _, stats := range containers {
+		containerStats := *stats
+		sample.Containers = append(sample.Containers, &containerStats)
+	}
+	return sample
+}
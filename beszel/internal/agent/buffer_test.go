@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var bufferStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Returns a sample taken the number of minutes after bufferStart
+func testSample(minute int) system.Sample {
+	return system.Sample{Time: bufferStart.Add(time.Duration(minute) * time.Minute), Stats: system.Stats{Cpu: float64(minute)}}
+}
+
+// Returns the minutes of the samples
+func sampleMinutes(samples []system.Sample) []int {
+	minutes := make([]int, 0, len(samples))
+	for _, sample := range samples {
+		minutes = append(minutes, int(sample.Time.Sub(bufferStart)/time.Minute))
+	}
+	return minutes
+}
+
+func TestSampleBufferSince(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int // samples added, one per minute starting at minute 1
+		since int // minute the hub has data up to
+		want  []int
+	}{
+		{name: "empty", size: 4, added: 0, since: 0, want: []int{}},
+		{name: "all samples", size: 4, added: 3, since: 0, want: []int{1, 2, 3}},
+		{name: "newer samples", size: 4, added: 3, since: 1, want: []int{2, 3}},
+		{name: "sample at the time is excluded", size: 4, added: 3, since: 3, want: []int{}},
+		{name: "full", size: 4, added: 4, since: 0, want: []int{1, 2, 3, 4}},
+		{name: "wrapped", size: 4, added: 6, since: 0, want: []int{3, 4, 5, 6}},
+		{name: "wrapped twice", size: 3, added: 8, since: 6, want: []int{7, 8}},
+	}
+	for _, tt := range tests {
+		sb := &sampleBuffer{samples: make([]system.Sample, tt.size)}
+		for i := 1; i <= tt.added; i++ {
+			sb.add(testSample(i))
+		}
+		if got := sampleMinutes(sb.since(testSample(tt.since).Time)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		// older samples are dropped, the returned samples are kept until the hub has them
+		if got := sampleMinutes(sb.since(time.Time{})); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: buffer holds %v after since, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSampleBufferReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		samples  []int
+		want     []int
+		wantNext int
+		wantFull bool
+	}{
+		{name: "empty", size: 3, samples: nil, want: []int{}, wantNext: 0},
+		{name: "fewer than size", size: 3, samples: []int{1, 2}, want: []int{1, 2}, wantNext: 2},
+		{name: "exactly size", size: 3, samples: []int{1, 2, 3}, want: []int{1, 2, 3}, wantNext: 0, wantFull: true},
+		{name: "newest kept", size: 3, samples: []int{1, 2, 3, 4, 5}, want: []int{3, 4, 5}, wantNext: 0, wantFull: true},
+	}
+	for _, tt := range tests {
+		sb := &sampleBuffer{samples: make([]system.Sample, tt.size)}
+		// start from a wrapped ring
+		for i := 10; i < 15; i++ {
+			sb.add(testSample(i))
+		}
+		samples := make([]system.Sample, 0, len(tt.samples))
+		for _, minute := range tt.samples {
+			samples = append(samples, testSample(minute))
+		}
+		sb.reset(samples)
+		if got := sampleMinutes(sb.ordered()); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		if sb.next != tt.wantNext || sb.full != tt.wantFull {
+			t.Errorf("%s: next %d full %v, want %d %v", tt.name, sb.next, sb.full, tt.wantNext, tt.wantFull)
+		}
+		// new samples replace the oldest
+		sb.add(testSample(20))
+		want := append(tt.want, 20)
+		if len(want) > tt.size {
+			want = want[len(want)-tt.size:]
+		}
+		if got := sampleMinutes(sb.ordered()); !slices.Equal(got, want) {
+			t.Errorf("%s: after add got %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestSampleBufferFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer")
+	t.Setenv("BUFFER_FILE", path)
+	t.Setenv("BUFFER_SIZE", "3")
+
+	sb, err := newSampleBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		sb.add(testSample(i))
+	}
+
+	// samples survive a restart
+	loaded, err := newSampleBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := loaded.since(time.Time{})
+	if got := sampleMinutes(samples); !slices.Equal(got, []int{2, 3, 4}) {
+		t.Fatalf("loaded %v, want [2 3 4]", got)
+	}
+	if samples[2].Stats.Cpu != 4 || !samples[2].Time.Equal(testSample(4).Time) {
+		t.Errorf("loaded sample differs: %+v", samples[2])
+	}
+
+	// samples the hub received aren't loaded again
+	loaded.since(testSample(3).Time)
+	reloaded, err := newSampleBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sampleMinutes(reloaded.since(time.Time{})); !slices.Equal(got, []int{4}) {
+		t.Errorf("reloaded %v, want [4]", got)
+	}
+}
+
+func TestNewSampleBufferSize(t *testing.T) {
+	t.Setenv("BUFFER_FILE", "")
+	t.Setenv("BUFFER_SIZE", "0")
+	sb, err := newSampleBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sb.samples) != 1 {
+		t.Errorf("size = %d, want 1", len(sb.samples))
+	}
+	t.Setenv("BUFFER_SIZE", "abc")
+	if _, err := newSampleBuffer(); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
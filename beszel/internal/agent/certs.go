@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"beszel/internal/certs"
+	"beszel/internal/entities/check"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often certificates are re-checked. Results are cached between checks.
+const certCheckInterval = 10 * time.Minute
+
+type certManager struct {
+	sync.Mutex
+	targets   []string            // host:port endpoints or PEM file paths
+	results   []check.Certificate // Results from the last check
+	lastCheck time.Time           // Time of the last check
+}
+
+// Creates a cert manager from the CERTS environment variable.
+// Format: comma separated host:port endpoints or absolute paths to PEM files. Example:
+// CERTS="example.com:443,127.0.0.1:8443,/etc/ssl/certs/app.pem"
+func newCertManager(certsEnv string) *certManager {
+	cm := &certManager{}
+	for _, target := range strings.Split(certsEnv, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			slog.Info("Certificate check", "target", target)
+			cm.targets = append(cm.targets, target)
+		}
+	}
+	return cm
+}
+
+// Returns certificate details, refreshing them if the cache is stale
+func (cm *certManager) getCertificates() []check.Certificate {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if time.Since(cm.lastCheck) < certCheckInterval {
+		return cm.results
+	}
+
+	results := make([]check.Certificate, len(cm.targets))
+	var wg sync.WaitGroup
+	for i, target := range cm.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = certs.Inspect(target, 3*time.Second)
+		}()
+	}
+	wg.Wait()
+
+	cm.results = results
+	cm.lastCheck = time.Now()
+	return results
+}
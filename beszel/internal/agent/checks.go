@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"beszel/internal/entities/check"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+type checkManager struct {
+	checks  []serviceCheck // Checks to run on each poll
+	timeout time.Duration  // Timeout for a single check
+	client  *http.Client   // Client used for http checks
+}
+
+type serviceCheck struct {
+	name     string // Name reported to the hub
+	kind     string // http, tcp or icmp
+	target   string // URL for http checks, host:port for tcp, host for icmp
+	expected int    // Expected HTTP status code (0 accepts any 2xx or 3xx)
+}
+
+// Creates a check manager from the CHECKS environment variable.
+// Format: name=scheme://target[|status], separated by commas. Example:
+// CHECKS="api=http://127.0.0.1:8080/health|200,db=tcp://127.0.0.1:5432,gw=icmp://10.0.0.1"
+func newCheckManager(checksEnv string) (*checkManager, error) {
+	cm := &checkManager{timeout: 2 * time.Second}
+
+	if t, set := LookupEnv("CHECKS_TIMEOUT"); set {
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, err
+		}
+		cm.timeout = timeout
+	}
+
+	names := make(map[string]struct{})
+	for _, entry := range strings.Split(checksEnv, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		sc, err := parseServiceCheck(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := names[sc.name]; exists {
+			return nil, fmt.Errorf("duplicate check name: %s", sc.name)
+		}
+		names[sc.name] = struct{}{}
+		slog.Info("Service check", "name", sc.name, "type", sc.kind, "target", sc.target)
+		cm.checks = append(cm.checks, sc)
+	}
+
+	cm.client = &http.Client{
+		Timeout: cm.timeout,
+		// report the status of the configured url rather than the redirect target
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return cm, nil
+}
+
+// Parses a single check definition
+func parseServiceCheck(entry string) (serviceCheck, error) {
+	var sc serviceCheck
+	name, target, hasName := strings.Cut(entry, "=")
+	// no name given (the = belongs to the url query)
+	if !hasName || strings.Contains(name, "://") {
+		name, target, hasName = "", entry, false
+	}
+	target, status, hasStatus := strings.Cut(target, "|")
+	if hasStatus {
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			return sc, fmt.Errorf("invalid status for check %s: %s", entry, status)
+		}
+		sc.expected = code
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return sc, fmt.Errorf("invalid check %s: %w", entry, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		sc.kind = check.TypeHttp
+		sc.target = u.String()
+	case "tcp":
+		if u.Port() == "" {
+			return sc, fmt.Errorf("missing port for tcp check: %s", entry)
+		}
+		sc.kind = check.TypeTcp
+		sc.target = u.Host
+	case "icmp", "ping":
+		sc.kind = check.TypeIcmp
+		sc.target = u.Hostname()
+	default:
+		return sc, fmt.Errorf("unsupported check scheme: %s", entry)
+	}
+	if sc.expected > 0 && sc.kind != check.TypeHttp {
+		return sc, fmt.Errorf("status is only valid for http checks: %s", entry)
+	}
+
+	sc.name = strings.TrimSpace(name)
+	if !hasName || sc.name == "" {
+		sc.name = sc.target
+	}
+	return sc, nil
+}
+
+// Runs all checks concurrently and returns the results
+func (cm *checkManager) runChecks() []*check.Stats {
+	results := make([]*check.Stats, len(cm.checks))
+	var wg sync.WaitGroup
+	for i := range cm.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = cm.runCheck(&cm.checks[i])
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Runs a single check and returns the result
+func (cm *checkManager) runCheck(sc *serviceCheck) *check.Stats {
+	result := &check.Stats{Name: sc.name, Type: sc.kind}
+	start := time.Now()
+
+	var err error
+	switch sc.kind {
+	case check.TypeHttp:
+		result.Status, err = cm.checkHttp(sc)
+	case check.TypeTcp:
+		err = cm.checkTcp(sc)
+	case check.TypeIcmp:
+		err = pingHost(sc.target, cm.timeout)
+	}
+
+	result.Latency = twoDecimals(float64(time.Since(start).Microseconds()) / 1000)
+	if err != nil {
+		result.Error = err.Error()
+		slog.Debug("Check failed", "name", sc.name, "err", err)
+		return result
+	}
+	result.Up = 1
+	return result
+}
+
+// Requests the url and compares the response status to the expected status
+func (cm *checkManager) checkHttp(sc *serviceCheck) (int, error) {
+	resp, err := cm.client.Get(sc.target)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case sc.expected > 0 && resp.StatusCode != sc.expected:
+		return resp.StatusCode, fmt.Errorf("expected status %d, got %d", sc.expected, resp.StatusCode)
+	case sc.expected == 0 && resp.StatusCode >= 400:
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Opens a tcp connection to the target
+func (cm *checkManager) checkTcp(sc *serviceCheck) error {
+	conn, err := net.DialTimeout("tcp", sc.target, cm.timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Sends an ICMP echo request to the host and waits for the reply.
+// Uses an unprivileged datagram socket if allowed by net.ipv4.ping_group_range,
+// otherwise falls back to a raw socket (requires CAP_NET_RAW).
+func pingHost(host string, timeout time.Duration) error {
+	addr, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return err
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: addr.IP}
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		dst = addr
+		if conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte("beszel")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			return err
+		}
+		// raw sockets receive all icmp traffic, so ignore replies from other hosts
+		if peerIP := peerAddrIP(peer); peerIP != nil && !peerIP.Equal(addr.IP) {
+			continue
+		}
+		rm, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), reply[:n])
+		if err != nil {
+			continue
+		}
+		if rm.Type == ipv4.ICMPTypeEchoReply {
+			return nil
+		}
+	}
+}
+
+// Returns the ip of an address returned by an icmp connection
+func peerAddrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"beszel/internal/entities/check"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseServiceCheck(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    serviceCheck
+		wantErr bool
+	}{
+		{entry: "api=http://127.0.0.1:8080/health", want: serviceCheck{name: "api", kind: check.TypeHttp, target: "http://127.0.0.1:8080/health"}},
+		{entry: "api=https://example.com|204", want: serviceCheck{name: "api", kind: check.TypeHttp, target: "https://example.com", expected: 204}},
+		{entry: "http://example.com/?a=b", want: serviceCheck{name: "http://example.com/?a=b", kind: check.TypeHttp, target: "http://example.com/?a=b"}},
+		{entry: "db=tcp://127.0.0.1:5432", want: serviceCheck{name: "db", kind: check.TypeTcp, target: "127.0.0.1:5432"}},
+		{entry: "tcp://127.0.0.1:5432", want: serviceCheck{name: "127.0.0.1:5432", kind: check.TypeTcp, target: "127.0.0.1:5432"}},
+		{entry: "gw=icmp://10.0.0.1", want: serviceCheck{name: "gw", kind: check.TypeIcmp, target: "10.0.0.1"}},
+		{entry: "gw=ping://10.0.0.1", want: serviceCheck{name: "gw", kind: check.TypeIcmp, target: "10.0.0.1"}},
+		{entry: " =tcp://127.0.0.1:22", want: serviceCheck{name: "127.0.0.1:22", kind: check.TypeTcp, target: "127.0.0.1:22"}},
+		{entry: "db=tcp://127.0.0.1", wantErr: true},
+		{entry: "db=tcp://127.0.0.1:5432|200", wantErr: true},
+		{entry: "api=http://127.0.0.1|abc", wantErr: true},
+		{entry: "api=http://127.0.0.1|600", wantErr: true},
+		{entry: "x=ftp://127.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseServiceCheck(tt.entry)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tt.entry, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.entry, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestNewCheckManagerDuplicateName(t *testing.T) {
+	if _, err := newCheckManager("a=tcp://127.0.0.1:1,a=tcp://127.0.0.1:2"); err == nil {
+		t.Error("expected an error for duplicate check names")
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/fail", http.StatusFound) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// find a port with nothing listening on it
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		entry  string
+		up     bool
+		status int
+	}{
+		{entry: "ok=" + server.URL + "/ok", up: true, status: 200},
+		{entry: "empty=" + server.URL + "/empty|204", up: true, status: 204},
+		{entry: "wrong=" + server.URL + "/ok|204", up: false, status: 200},
+		{entry: "fail=" + server.URL + "/fail", up: false, status: 500},
+		{entry: "moved=" + server.URL + "/moved", up: true, status: 302},
+		{entry: "tcp=tcp://" + listener.Addr().String(), up: true},
+		{entry: "closed=tcp://" + closedAddr, up: false},
+	}
+	var env string
+	for i, tt := range tests {
+		if i > 0 {
+			env += ","
+		}
+		env += tt.entry
+	}
+	cm, err := newCheckManager(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := cm.runChecks()
+	if len(results) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(results), len(tests))
+	}
+	for i, tt := range tests {
+		result := results[i]
+		if up := result.Up == 1; up != tt.up {
+			t.Errorf("%s: up = %v, want %v (error %q)", result.Name, up, tt.up, result.Error)
+		}
+		if result.Status != tt.status {
+			t.Errorf("%s: status = %d, want %d", result.Name, result.Status, tt.status)
+		}
+		if tt.up == (result.Error != "") {
+			t.Errorf("%s: unexpected error %q", result.Name, result.Error)
+		}
+	}
+}
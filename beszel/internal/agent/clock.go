@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock synchronization status reported by chrony or systemd-timesyncd
+type clockStatus struct {
+	synced bool
+	offset float64 // Milliseconds the local clock is ahead of NTP time (negative if behind)
+}
+
+// Returns the clock sync status from chronyc or timedatectl.
+// Returns false if neither is available.
+func getClockStatus() (clockStatus, bool) {
+	if _, err := exec.LookPath("chronyc"); err == nil {
+		if output, err := runClockCommand("chronyc", "tracking"); err == nil {
+			if status, ok := parseChronyTracking(output); ok {
+				return status, true
+			}
+		}
+	}
+	if _, err := exec.LookPath("timedatectl"); err == nil {
+		if output, err := runClockCommand("timedatectl", "timesync-status"); err == nil {
+			if status, ok := parseTimesyncStatus(output); ok {
+				return status, true
+			}
+		}
+		// timesync-status requires systemd-timesyncd, fall back to the sync flag only
+		if output, err := runClockCommand("timedatectl", "show", "--property=NTPSynchronized", "--value"); err == nil {
+			return clockStatus{synced: strings.TrimSpace(string(output)) == "yes"}, true
+		}
+	}
+	return clockStatus{}, false
+}
+
+func runClockCommand(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = []string{"LANG=C", "LC_ALL=C"}
+	return cmd.Output()
+}
+
+// Parses `chronyc tracking` output:
+// System time     : 0.000012345 seconds fast of NTP time
+// Leap status     : Normal
+func parseChronyTracking(output []byte) (clockStatus, bool) {
+	var status clockStatus
+	var found bool
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "System time":
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				continue
+			}
+			if fields[2] == "slow" {
+				seconds = -seconds
+			}
+			status.offset = twoDecimals(seconds * 1000)
+			found = true
+		case "Leap status":
+			status.synced = value != "Not synchronised"
+		}
+	}
+	return status, found
+}
+
+// Parses `timedatectl timesync-status` output. The reported offset is the
+// correction applied to the local clock, so the sign is reversed.
+//
+//	Offset: -1.234ms
+func parseTimesyncStatus(output []byte) (clockStatus, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "Offset" {
+			continue
+		}
+		offset, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return clockStatus{}, false
+		}
+		return clockStatus{
+			synced: true,
+			offset: twoDecimals(-float64(offset) / float64(time.Millisecond)),
+		}, true
+	}
+	return clockStatus{}, false
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file read if CONFIG_FILE is not set
+const defaultConfigFile = "/etc/beszel-agent/config.yml"
+
+// Settings that only take effect after a restart
+var restartSettings = []string{
+	"PORT", "HUB_URL", "TOKEN", "DATA_DIR", "HOST_KEY_FILE", "STATSD_ADDR", "LOG_WATCH",
+	"EVENTS", "UPDATES", "UPDATES_INTERVAL", "SESSIONS", "AUTH_LOG", "BUFFER", "BUFFER_SIZE", "BUFFER_FILE",
+	"SAMPLING", "SAMPLE_INTERVAL",
+}
+
+// Session env var the hub sends its managed settings in
+const remoteConfigEnv = "BESZEL_CONFIG"
+
+// Settings the hub can manage, which are applied without a restart
+var remoteSettings = []string{
+	"LOG_LEVEL", "MEM_CALC", "SENSORS", "FILESYSTEM", "EXTRA_FILESYSTEMS", "NICS",
+	"DOCKER_TIMEOUT", "PORTS", "LIBVIRT", "LXC", "WIREGUARD",
+}
+
+var (
+	configLock   sync.RWMutex
+	configValues map[string]string // Settings from the config file by env var name
+	remoteValues map[string]string // Settings sent by the hub by env var name
+)
+
+// Loads agent settings from CONFIG_FILE or /etc/beszel-agent/config.yml.
+// The file is a YAML mapping of env var names to values, for example:
+//
+//	key: ssh-ed25519 AAAA...
+//	nics: [eth0, wg0]
+//	extra_filesystems: sdb1,sdc1
+//	docker_timeout: 5s
+//
+// Names are case insensitive and lists are joined with commas. Env vars
+// and settings sent by the hub override values from the file. A missing
+// default file is not an error.
+func LoadConfig() error {
+	path, exists := os.LookupEnv("CONFIG_FILE")
+	if !exists {
+		path = defaultConfigFile
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !exists {
+		// clear settings in case the file was deleted before a reload
+		configLock.Lock()
+		configValues = nil
+		configLock.Unlock()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	values, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	configLock.Lock()
+	configValues = values
+	configLock.Unlock()
+	slog.Debug("Loaded config", "path", path, "settings", len(values))
+	return nil
+}
+
+// Converts the YAML mapping to env var names and string values
+func parseConfig(data []byte) (map[string]string, error) {
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return configStrings(raw)
+}
+
+// Converts setting values to strings, joining lists with commas
+func configStrings(raw map[string]any) (map[string]string, error) {
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		name := strings.ToUpper(key)
+		switch v := value.(type) {
+		case nil:
+			values[name] = ""
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]any:
+			return nil, fmt.Errorf("%s: expected a value or list", key)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// Returns the value of the env var if it's set, then the setting sent by the
+// hub, then the setting from the config file
+func LookupEnv(key string) (string, bool) {
+	if value, exists := os.LookupEnv(key); exists {
+		return value, true
+	}
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if value, exists := remoteValues[key]; exists {
+		return value, true
+	}
+	value, exists := configValues[key]
+	return value, exists
+}
+
+// Returns the value of LookupEnv, or an empty string if the setting doesn't exist
+func GetEnv(key string) string {
+	value, _ := LookupEnv(key)
+	return value
+}
+
+// Reloads the config file and authorized keys on SIGHUP
+func (a *Agent) handleReloads(keys *authorizedKeys) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		slog.Info("Reloading config")
+		previous := make(map[string]string, len(restartSettings))
+		for _, key := range restartSettings {
+			previous[key] = GetEnv(key)
+		}
+		if err := LoadConfig(); err != nil {
+			slog.Error("Error reloading config", "err", err)
+			continue
+		}
+		for _, key := range restartSettings {
+			if GetEnv(key) != previous[key] {
+				slog.Warn("Setting changed, restart required", "setting", key)
+			}
+		}
+		a.Lock()
+		a.applyConfig()
+		a.Unlock()
+		keys.reload()
+	}
+}
+
+// Sets the settings managed by the hub from a JSON object. Settings the hub
+// can't manage are ignored. Returns true if the settings changed.
+func setRemoteConfig(data string) (bool, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return false, err
+	}
+	received, err := configStrings(raw)
+	if err != nil {
+		return false, err
+	}
+	values := make(map[string]string, len(received))
+	for key, value := range received {
+		if slices.Contains(remoteSettings, key) {
+			values[key] = value
+		} else {
+			slog.Warn("Ignoring setting from hub", "setting", key)
+		}
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	if maps.Equal(values, remoteValues) {
+		return false, nil
+	}
+	remoteValues = values
+	return true, nil
+}
+
+// Returns the settings the hub can manage that are currently set, from any source
+func effectiveConfig() map[string]string {
+	config := make(map[string]string)
+	for _, key := range remoteSettings {
+		if value, exists := LookupEnv(key); exists {
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// Applies settings the hub sends in the BESZEL_CONFIG session env var if they
+// changed. Disabled with REMOTE_CONFIG=false.
+func (a *Agent) applyRemoteConfig(environ []string) {
+	if GetEnv("REMOTE_CONFIG") == "false" {
+		return
+	}
+	for _, kv := range environ {
+		data, found := strings.CutPrefix(kv, remoteConfigEnv+"=")
+		if !found {
+			continue
+		}
+		changed, err := setRemoteConfig(data)
+		if err != nil {
+			slog.Error("Invalid config from hub", "err", err)
+			return
+		}
+		if changed {
+			slog.Info("Applying config from hub")
+			a.applyConfig()
+		}
+		return
+	}
+}
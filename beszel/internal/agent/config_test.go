@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Restores the settings from the config file and hub after the test
+func resetConfig(t *testing.T) {
+	t.Helper()
+	configLock.Lock()
+	savedConfig, savedRemote := configValues, remoteValues
+	configValues, remoteValues = nil, nil
+	configLock.Unlock()
+	t.Cleanup(func() {
+		configLock.Lock()
+		configValues, remoteValues = savedConfig, savedRemote
+		configLock.Unlock()
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "values",
+			data: "key: ssh-ed25519 AAAA\nport: 45876\nlog_level: debug\n",
+			want: map[string]string{"KEY": "ssh-ed25519 AAAA", "PORT": "45876", "LOG_LEVEL": "debug"},
+		},
+		{
+			name: "lists are joined",
+			data: "nics: [eth0, wg0]\nextra_filesystems:\n  - sdb1\n  - sdc1\n",
+			want: map[string]string{"NICS": "eth0,wg0", "EXTRA_FILESYSTEMS": "sdb1,sdc1"},
+		},
+		{
+			name: "names are case insensitive",
+			data: "Docker_Timeout: 5s\nSENSORS: \"\"\n",
+			want: map[string]string{"DOCKER_TIMEOUT": "5s", "SENSORS": ""},
+		},
+		{
+			name: "booleans and empty values",
+			data: "ports: false\nfilesystem:\n",
+			want: map[string]string{"PORTS": "false", "FILESYSTEM": ""},
+		},
+		{
+			name: "empty file",
+			data: "",
+			want: map[string]string{},
+		},
+		{
+			name:    "nested mapping",
+			data:    "docker:\n  timeout: 5s\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			data:    "key: [unterminated\n",
+			wantErr: true,
+		},
+		{
+			name:    "not a mapping",
+			data:    "- a\n- b\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseConfig([]byte(tt.data))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	resetConfig(t)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	t.Setenv("CONFIG_FILE", path)
+
+	// a missing file set with CONFIG_FILE is an error
+	if err := LoadConfig(); err == nil {
+		t.Error("expected an error for a missing CONFIG_FILE")
+	}
+
+	if err := os.WriteFile(path, []byte("mem_calc: htop\nnics: [eth0]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if GetEnv("MEM_CALC") != "htop" || GetEnv("NICS") != "eth0" {
+		t.Errorf("settings not loaded: MEM_CALC=%q NICS=%q", GetEnv("MEM_CALC"), GetEnv("NICS"))
+	}
+
+	// an invalid file keeps the current settings
+	if err := os.WriteFile(path, []byte("nics: [eth0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	if GetEnv("MEM_CALC") != "htop" {
+		t.Error("settings were cleared by an invalid file")
+	}
+}
+
+func TestLoadConfigDefaultFileRemoved(t *testing.T) {
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		t.Skip(defaultConfigFile + " exists")
+	}
+	resetConfig(t)
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+
+	configLock.Lock()
+	configValues = map[string]string{"MEM_CALC": "htop"}
+	configLock.Unlock()
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := LookupEnv("MEM_CALC"); exists {
+		t.Error("settings from the removed default file were kept")
+	}
+}
+
+func TestLookupEnvPrecedence(t *testing.T) {
+	resetConfig(t)
+	configLock.Lock()
+	configValues = map[string]string{"NICS": "file", "SENSORS": "file", "LXC": "file"}
+	configLock.Unlock()
+	if _, err := setRemoteConfig(`{"nics":"hub","sensors":"hub"}`); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NICS", "env")
+
+	for key, want := range map[string]string{"NICS": "env", "SENSORS": "hub", "LXC": "file"} {
+		if got := GetEnv(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestSetRemoteConfig(t *testing.T) {
+	resetConfig(t)
+	changed, err := setRemoteConfig(`{"nics":["eth0","eth1"],"key":"ignored"}`)
+	if err != nil || !changed {
+		t.Fatalf("got %v %v, want a change", changed, err)
+	}
+	if got := GetEnv("NICS"); got != "eth0,eth1" {
+		t.Errorf("NICS = %q", got)
+	}
+	configLock.RLock()
+	_, hasKey := remoteValues["KEY"]
+	configLock.RUnlock()
+	if hasKey {
+		t.Error("hub set a setting it can't manage")
+	}
+	if changed, err := setRemoteConfig(`{"nics":"eth0,eth1"}`); err != nil || changed {
+		t.Errorf("got %v %v, want no change", changed, err)
+	}
+	if _, err := setRemoteConfig(`{"nics":{"a":1}}`); err == nil {
+		t.Error("expected an error for a nested value")
+	}
+	if _, err := setRemoteConfig(`not json`); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
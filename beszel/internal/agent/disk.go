@@ -14,7 +14,11 @@ import (
 
 // Disk kullanımı ve I/O için izlenecek dosya sistemlerini ayarlar.
 func (a *Agent) initializeDiskInfo() {
-	filesystem := os.Getenv("FILESYSTEM")
+	// İzlenen dosya sistemlerini sıfırla
+	a.fsNames = nil
+	a.fsStats = make(map[string]*system.FsStats)
+
+	filesystem := GetEnv("FILESYSTEM")
 	efPath := "/extra-filesystems"
 	hasRoot := false
 
@@ -72,7 +76,7 @@ func (a *Agent) initializeDiskInfo() {
 	}
 
 	// EXTRA_FILESYSTEMS ortam değişkeni değerlerini fsStats'a ekle
-	if extraFilesystems, exists := os.LookupEnv("EXTRA_FILESYSTEMS"); exists {
+	if extraFilesystems, exists := LookupEnv("EXTRA_FILESYSTEMS"); exists {
 		for _, fs := range strings.Split(extraFilesystems, ",") {
 			found := false
 			for _, p := range partitions {
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"beszel/internal/entities/system"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	hubjson "github.com/goccy/go-json"
+)
+
+// Stats of a busy host with many containers and filesystems
+func benchmarkData() system.CombinedData {
+	data := system.CombinedData{
+		Stats: system.Stats{
+			Cpu: 23.45, MaxCpu: 71.2, Mem: 62.74, MemUsed: 31.08, MemPct: 49.54, MemBuffCache: 20.11,
+			Swap: 8, SwapUsed: 0.41, DiskTotal: 1862.28, DiskUsed: 1043.97, DiskPct: 56.06,
+			DiskReadPs: 1.32, DiskWritePs: 4.87, NetworkSent: 2.11, NetworkRecv: 13.57,
+			Temperatures: map[string]float64{"coretemp_package_id_0": 54, "nvme_composite": 41.85},
+			ExtraFs:      map[string]*system.FsStats{},
+		},
+		Info: system.Info{
+			Hostname: "bench", KernelVersion: "6.8.0-45-generic", Cores: 16, Threads: 32,
+			CpuModel: "AMD Ryzen 9 5950X 16-Core Processor", Uptime: 1234567, Cpu: 23.45,
+			MemPct: 49.54, DiskPct: 56.06, Bandwidth: 15.68, AgentVersion: "0.9.1",
+		},
+		// whole seconds, cbor encodes times as seconds and rounds nanoseconds
+		Time: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+	for i := range 4 {
+		data.Stats.ExtraFs[fmt.Sprintf("sd%c", 'b'+i)] = &system.FsStats{DiskTotal: 3726.02, DiskUsed: 1890.4, DiskReadPs: 0.52, DiskWritePs: 1.1}
+	}
+	for i := range 100 {
+		data.Containers = append(data.Containers, &container.Stats{
+			Name: fmt.Sprintf("service-%03d", i), Cpu: float64(i%17) * 0.37, Mem: 128.5 + float64(i),
+			NetworkSent: 0.02 * float64(i%5), NetworkRecv: 0.04 * float64(i%7),
+		})
+	}
+	return data
+}
+
+// Decoders used by the hub for each encoding
+var hubDecoders = map[string]func(io.Reader, any) error{
+	system.EncodingJSON: func(r io.Reader, v any) error { return hubjson.NewDecoder(r).Decode(v) },
+	system.EncodingCBOR: func(r io.Reader, v any) error { return cbor.NewDecoder(r).Decode(v) },
+}
+
+// Returns the data encoded by the agent and decoded by the hub
+func roundTrip(t *testing.T, encoding string, data system.CombinedData) system.CombinedData {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encodeResponse(&buf, []string{"BESZEL_ENCODING=" + encoding}, data); err != nil {
+		t.Fatalf("%s: %v", encoding, err)
+	}
+	var decoded system.CombinedData
+	if err := hubDecoders[encoding](&buf, &decoded); err != nil {
+		t.Fatalf("%s: %v", encoding, err)
+	}
+	return decoded
+}
+
+func TestEncodeResponseRoundTrip(t *testing.T) {
+	data := benchmarkData()
+	data.Ports = []system.ListeningPort{}
+	fromJSON := roundTrip(t, system.EncodingJSON, data)
+	fromCBOR := roundTrip(t, system.EncodingCBOR, data)
+	// cbor times decode in the local time zone
+	if !fromJSON.Time.Equal(fromCBOR.Time) {
+		t.Errorf("json time %v, cbor time %v", fromJSON.Time, fromCBOR.Time)
+	}
+	fromCBOR.Time = fromJSON.Time
+	if !reflect.DeepEqual(fromJSON, fromCBOR) {
+		t.Errorf("json and cbor decode differently:\njson %+v\ncbor %+v", fromJSON, fromCBOR)
+	}
+	// compare as json, which ignores fields that aren't sent
+	want, _ := hubjson.Marshal(data)
+	if got, _ := hubjson.Marshal(fromCBOR); !bytes.Equal(got, want) {
+		t.Errorf("decoded data differs from the original:\n got %s\nwant %s", got, want)
+	}
+	// nil and empty are told apart, e.g. no ports reported and none listening
+	if fromJSON.Ports == nil || fromCBOR.Ports == nil || fromJSON.Checks != nil || fromCBOR.Checks != nil {
+		t.Error("nil and empty slices aren't kept")
+	}
+}
+
+func benchmarkEncode(b *testing.B, encoding string) {
+	data := benchmarkData()
+	environ := []string{"BESZEL_ENCODING=" + encoding}
+	var buf bytes.Buffer
+	if err := encodeResponse(&buf, environ, data); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		encodeResponse(io.Discard, environ, data)
+	}
+	b.ReportMetric(float64(buf.Len()), "bytes/response")
+}
+
+func benchmarkDecode(b *testing.B, encoding string) {
+	var buf bytes.Buffer
+	if err := encodeResponse(&buf, []string{"BESZEL_ENCODING=" + encoding}, benchmarkData()); err != nil {
+		b.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		var decoded system.CombinedData
+		if err := hubDecoders[encoding](bytes.NewReader(encoded), &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(encoded)), "bytes/response")
+}
+
+func BenchmarkEncodeJSON(b *testing.B) { benchmarkEncode(b, system.EncodingJSON) }
+func BenchmarkEncodeCBOR(b *testing.B) { benchmarkEncode(b, system.EncodingCBOR) }
+func BenchmarkDecodeJSON(b *testing.B) { benchmarkDecode(b, system.EncodingJSON) }
+func BenchmarkDecodeCBOR(b *testing.B) { benchmarkDecode(b, system.EncodingCBOR) }
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// Maximum number of events returned per poll
+const maxEvents = 50
+
+// Syslog priorities at or below this level (err) are collected
+const eventMaxPriority = 3
+
+type eventCollector struct {
+	sync.Mutex
+	kmsg          *os.File  // /dev/kmsg opened in non-blocking mode
+	bootTime      time.Time // Used to convert kmsg timestamps
+	journal       bool      // True if journalctl is available
+	journalCursor string    // Cursor of the last journal entry read
+	journalSince  time.Time // Start time used until a cursor is known
+}
+
+// Creates an event collector reading the kernel ring buffer and systemd journal.
+// Returns nil if neither source is available.
+func newEventCollector() *eventCollector {
+	ec := &eventCollector{journalSince: time.Now()}
+
+	if kmsg, err := os.OpenFile("/dev/kmsg", os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+		// skip existing messages
+		if _, err := kmsg.Seek(0, io.SeekEnd); err != nil {
+			slog.Debug("kmsg seek", "err", err)
+		}
+		ec.kmsg = kmsg
+		if bootTime, err := host.BootTime(); err == nil {
+			ec.bootTime = time.Unix(int64(bootTime), 0)
+		}
+	} else {
+		slog.Debug("Not reading kernel messages", "err", err)
+	}
+
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		ec.journal = true
+	}
+
+	if ec.kmsg == nil && !ec.journal {
+		slog.Debug("No event sources available")
+		return nil
+	}
+	slog.Info("Collecting system events", "kmsg", ec.kmsg != nil, "journal", ec.journal)
+	return ec
+}
+
+// Returns error events logged since the last call, deduplicated and capped
+func (ec *eventCollector) collect() []system.Event {
+	ec.Lock()
+	defer ec.Unlock()
+
+	var events []system.Event
+	if ec.kmsg != nil {
+		events = append(events, ec.readKmsg()...)
+	}
+	if ec.journal {
+		journalEvents, err := ec.readJournal()
+		if err != nil {
+			slog.Debug("Error reading journal", "err", err)
+		}
+		events = append(events, journalEvents...)
+	}
+	return dedupeEvents(events)
+}
+
+// Reads new records from /dev/kmsg. Each read returns a single record:
+// "priority,sequence,timestamp_us,flags;message"
+func (ec *eventCollector) readKmsg() []system.Event {
+	var events []system.Event
+	rawConn, err := ec.kmsg.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	buf := make([]byte, 8192)
+	for {
+		// read the fd directly, os.File.Read would wait in the poller instead of returning EAGAIN
+		var n int
+		var readErr error
+		if err := rawConn.Read(func(fd uintptr) bool {
+			n, readErr = syscall.Read(int(fd), buf)
+			return true
+		}); err != nil {
+			break
+		}
+		if err := readErr; err != nil || n <= 0 {
+			// EPIPE means records were overwritten before we read them, keep reading
+			if errors.Is(err, syscall.EPIPE) {
+				continue
+			}
+			// EAGAIN means there are no more records
+			break
+		}
+		if event, ok := ec.parseKmsg(buf[:n]); ok {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Parses a kmsg record, returning false if it's below the priority threshold
+func (ec *eventCollector) parseKmsg(record []byte) (system.Event, bool) {
+	header, message, found := bytes.Cut(record, []byte(";"))
+	if !found {
+		return system.Event{}, false
+	}
+	fields := strings.Split(string(header), ",")
+	if len(fields) < 3 {
+		return system.Event{}, false
+	}
+	prefix, err := strconv.Atoi(fields[0])
+	if err != nil || prefix&7 > eventMaxPriority {
+		return system.Event{}, false
+	}
+	event := system.Event{
+		Time:     time.Now().UTC(),
+		Source:   "kernel",
+		Priority: uint8(prefix & 7),
+		// continuation lines start with a space and contain key=value pairs
+		Message: strings.TrimSpace(string(bytes.SplitN(message, []byte("\n"), 2)[0])),
+	}
+	if usec, err := strconv.ParseInt(fields[2], 10, 64); err == nil && !ec.bootTime.IsZero() {
+		event.Time = ec.bootTime.Add(time.Duration(usec) * time.Microsecond).UTC()
+	}
+	return event, true
+}
+
+// Reads new journal entries at priority err or higher
+func (ec *eventCollector) readJournal() ([]system.Event, error) {
+	args := []string{"--no-pager", "--output=json", "--priority=0.." + strconv.Itoa(eventMaxPriority)}
+	if ec.journalCursor != "" {
+		args = append(args, "--after-cursor="+ec.journalCursor)
+	} else {
+		args = append(args, "--since=@"+strconv.FormatInt(ec.journalSince.Unix(), 10))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return ec.parseJournal(output), nil
+}
+
+// Parses journalctl json output (one object per line) and updates the cursor
+func (ec *eventCollector) parseJournal(output []byte) []system.Event {
+	var events []system.Event
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry struct {
+			Cursor     string `json:"__CURSOR"`
+			Timestamp  string `json:"__REALTIME_TIMESTAMP"`
+			Priority   string `json:"PRIORITY"`
+			Message    any    `json:"MESSAGE"`
+			Identifier string `json:"SYSLOG_IDENTIFIER"`
+			Unit       string `json:"_SYSTEMD_UNIT"`
+			Transport  string `json:"_TRANSPORT"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		ec.journalCursor = entry.Cursor
+		// MESSAGE is an array of bytes if it's not valid utf-8
+		message, ok := entry.Message.(string)
+		if !ok {
+			continue
+		}
+		// skip kernel messages if they're read from kmsg
+		if entry.Transport == "kernel" && ec.kmsg != nil {
+			continue
+		}
+		priority, _ := strconv.Atoi(entry.Priority)
+		event := system.Event{
+			Source:   entry.Unit,
+			Priority: uint8(priority),
+			Message:  strings.TrimSpace(message),
+			Time:     time.Now().UTC(),
+		}
+		if event.Source == "" {
+			event.Source = entry.Identifier
+		}
+		if entry.Transport == "kernel" {
+			event.Source = "kernel"
+		}
+		if usec, err := strconv.ParseInt(entry.Timestamp, 10, 64); err == nil {
+			event.Time = time.UnixMicro(usec).UTC()
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Merges events with the same source and message, keeping the latest time,
+// and returns at most maxEvents events, preferring the most recent
+func dedupeEvents(events []system.Event) []system.Event {
+	if len(events) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(events))
+	deduped := make([]system.Event, 0, len(events))
+	for _, event := range events {
+		key := event.Source + "\x00" + event.Message
+		if i, exists := index[key]; exists {
+			deduped[i].Count++
+			if event.Time.After(deduped[i].Time) {
+				deduped[i].Time = event.Time
+			}
+			continue
+		}
+		event.Count = 1
+		index[key] = len(deduped)
+		deduped = append(deduped, event)
+	}
+	if len(deduped) > maxEvents {
+		deduped = deduped[len(deduped)-maxEvents:]
+	}
+	return deduped
+}
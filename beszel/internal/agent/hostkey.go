@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Directories tried for agent data if DATA_DIR is not set
+var dataDirs = []string{"/var/lib/beszel-agent"}
+
+// Returns a writable directory for persistent agent data. Uses DATA_DIR if set,
+// then /var/lib/beszel-agent, then beszel-agent in the user's config directory.
+func getDataDir() (string, error) {
+	if dir, exists := LookupEnv("DATA_DIR"); exists {
+		return dir, os.MkdirAll(dir, 0o700)
+	}
+	dirs := dataDirs
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "beszel-agent"))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			continue
+		}
+		// make sure files can be created, e.g. if the directory is owned by root
+		if file, err := os.CreateTemp(dir, ".write-test"); err == nil {
+			file.Close()
+			os.Remove(file.Name())
+			return dir, nil
+		}
+	}
+	return "", errors.New("no writable data directory, set DATA_DIR")
+}
+
+// Loads the SSH host key from HOST_KEY_FILE or host_key in the data directory,
+// generating it on first start. The hub pins this key, so it must stay the same
+// across restarts. Falls back to a temporary key if it can't be saved.
+func loadHostKey() (gossh.Signer, error) {
+	path, exists := LookupEnv("HOST_KEY_FILE")
+	if !exists {
+		dataDir, err := getDataDir()
+		if err != nil {
+			slog.Warn("Host key will change on restart", "err", err)
+			return generateHostKey("")
+		}
+		path = filepath.Join(dataDir, "host_key")
+	}
+	if key, err := os.ReadFile(path); err == nil {
+		return gossh.ParsePrivateKey(key)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return generateHostKey(path)
+}
+
+// Generates an ed25519 host key and saves it to path if path is not empty
+func generateHostKey(path string) (gossh.Signer, error) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := gossh.NewSignerFromKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return signer, nil
+	}
+	block, err := gossh.MarshalPrivateKey(privKey, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		slog.Warn("Host key will change on restart", "err", err)
+		return signer, nil
+	}
+	slog.Info("Generated host key", "path", path)
+	return signer, nil
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/mem"
+	psutilNet "github.com/shirou/gopsutil/v4/net"
+)
+
+// Interval between inventory refreshes
+const inventoryInterval = 15 * time.Minute
+
+// Block devices that aren't physical disks
+var virtualDiskPrefixes = []string{"loop", "ram", "zram", "dm-", "md", "nbd", "sr"}
+
+// Refreshes the inventory if it's older than inventoryInterval
+func (a *Agent) refreshInventory() {
+	if time.Since(a.inventoryUpdated) < inventoryInterval {
+		return
+	}
+	a.inventoryUpdated = time.Now()
+	a.systemInfo.Inventory = getInventory()
+	slog.Debug("Inventory", "data", a.systemInfo.Inventory)
+}
+
+// Collects OS, hardware and network details of the host
+func getInventory() *system.Inventory {
+	inv := &system.Inventory{Arch: runtime.GOARCH}
+
+	if platform, _, version, err := host.PlatformInformation(); err == nil {
+		inv.Os, inv.OsVersion = platform, version
+	}
+	if arch, err := host.KernelArch(); err == nil && arch != "" {
+		inv.Arch = arch
+	}
+	inv.Virtualization = "none"
+	if virt, role, err := host.Virtualization(); err == nil && role == "guest" && virt != "" {
+		inv.Virtualization = virt
+	}
+	inv.BootTime, _ = host.BootTime()
+	if v, err := mem.VirtualMemory(); err == nil {
+		inv.MemTotal = v.Total
+	}
+	inv.Interfaces = getInterfaceInventory()
+	inv.Disks = getDiskInventory()
+
+	// dmi info is only available on linux
+	inv.SysVendor = readDmi("sys_vendor")
+	inv.ProductName = readDmi("product_name")
+	inv.BoardVendor = readDmi("board_vendor")
+	inv.BoardName = readDmi("board_name")
+	inv.BiosVendor = readDmi("bios_vendor")
+	inv.BiosVersion = readDmi("bios_version")
+	return inv
+}
+
+// Returns addresses of physical and virtual interfaces, skipping loopback and container bridges
+func getInterfaceInventory() []system.InterfaceInfo {
+	interfaces, err := psutilNet.Interfaces()
+	if err != nil {
+		slog.Debug("Error getting interfaces", "err", err)
+		return nil
+	}
+	var result []system.InterfaceInfo
+	for _, iface := range interfaces {
+		if slices.Contains(iface.Flags, "loopback") ||
+			strings.HasPrefix(iface.Name, "docker") ||
+			strings.HasPrefix(iface.Name, "br-") ||
+			strings.HasPrefix(iface.Name, "veth") {
+			continue
+		}
+		info := system.InterfaceInfo{Name: iface.Name, Mac: iface.HardwareAddr}
+		for _, addr := range iface.Addrs {
+			// skip link-local ipv6 addresses
+			if strings.HasPrefix(addr.Addr, "fe80:") {
+				continue
+			}
+			info.Ips = append(info.Ips, addr.Addr)
+		}
+		if len(info.Ips) > 0 {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+// Returns model, serial and size of block devices from sysfs
+func getDiskInventory() []system.DiskInfo {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+	var disks []system.DiskInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if slices.ContainsFunc(virtualDiskPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		}) {
+			continue
+		}
+		dir := filepath.Join("/sys/block", name)
+		disk := system.DiskInfo{
+			Name:   name,
+			Model:  readSysfs(filepath.Join(dir, "device", "model")),
+			Serial: readSysfs(filepath.Join(dir, "device", "serial")),
+		}
+		// size is in 512 byte sectors regardless of the device's block size
+		if sectors, err := strconv.ParseUint(readSysfs(filepath.Join(dir, "size")), 10, 64); err == nil {
+			disk.Size = sectors * 512
+		}
+		if disk.Size == 0 {
+			continue
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// Reads a value from /sys/class/dmi/id
+func readDmi(name string) string {
+	return readSysfs(filepath.Join("/sys/class/dmi/id", name))
+}
+
+// Reads a sysfs attribute, returning an empty string if it's not readable
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
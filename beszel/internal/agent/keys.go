@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	sshServer "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Interval between checks of KEY_FILE for changes
+const keyFileCheckInterval = 30 * time.Second
+
+// Hub public keys allowed to connect, in authorized_keys format, so several
+// hubs or an old and a new hub key can be valid at the same time.
+type authorizedKeys struct {
+	sync.RWMutex
+	keys    []gossh.PublicKey
+	modTime time.Time // Modification time of KEY_FILE when last read
+}
+
+// Parses the keys from KEY or KEY_FILE. Keys are reloaded with the config on
+// SIGHUP, and KEY_FILE is also reloaded when it changes.
+func newAuthorizedKeys(data []byte) (*authorizedKeys, error) {
+	keys, err := parseAuthorizedKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	ak := &authorizedKeys{keys: keys}
+	if path := keyFile(); path != "" {
+		if info, err := os.Stat(path); err == nil {
+			ak.modTime = info.ModTime()
+		}
+	}
+	go ak.watch()
+	slog.Debug("Authorized keys", "count", len(keys))
+	return ak, nil
+}
+
+// Returns KEY_FILE, or an empty string if keys come from KEY
+func keyFile() string {
+	if GetEnv("KEY") != "" {
+		return ""
+	}
+	return GetEnv("KEY_FILE")
+}
+
+// Parses one key per line, skipping blank lines and comments
+func parseAuthorizedKeys(data []byte) ([]gossh.PublicKey, error) {
+	var keys []gossh.PublicKey
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := gossh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	return keys, nil
+}
+
+// Returns true if the key is one of the authorized keys
+func (ak *authorizedKeys) isAuthorized(key sshServer.PublicKey) bool {
+	ak.RLock()
+	defer ak.RUnlock()
+	for _, allowed := range ak.keys {
+		if sshServer.KeysEqual(key, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reloads KEY_FILE when its modification time changes
+func (ak *authorizedKeys) watch() {
+	ticker := time.NewTicker(keyFileCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		path := keyFile()
+		if path == "" {
+			continue
+		}
+		ak.RLock()
+		modTime := ak.modTime
+		ak.RUnlock()
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(modTime) {
+			ak.reload()
+		}
+	}
+}
+
+// Reads the keys from KEY or KEY_FILE again, keeping the current keys if they're invalid
+func (ak *authorizedKeys) reload() {
+	source := "KEY"
+	data := []byte(GetEnv("KEY"))
+	if path := keyFile(); path != "" {
+		source = path
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Error("Error reloading keys", "path", path, "err", err)
+			return
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			slog.Error("Error reloading keys", "path", path, "err", err)
+			return
+		}
+		// don't retry an invalid file until it changes again
+		ak.Lock()
+		ak.modTime = info.ModTime()
+		ak.Unlock()
+	}
+	keys, err := parseAuthorizedKeys(data)
+	if err != nil {
+		slog.Error("Error reloading keys", "source", source, "err", err)
+		return
+	}
+	ak.Lock()
+	ak.keys = keys
+	ak.Unlock()
+	slog.Info("Reloaded keys", "source", source, "count", len(keys))
+}
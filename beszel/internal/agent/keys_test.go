@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Returns a new public key in authorized_keys format without the trailing newline
+func testAuthorizedKey(t *testing.T) (gossh.PublicKey, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	key1, line1 := testAuthorizedKey(t)
+	key2, line2 := testAuthorizedKey(t)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []gossh.PublicKey
+		wantErr string
+	}{
+		{name: "single key", data: line1, want: []gossh.PublicKey{key1}},
+		{name: "key with comment", data: line1 + " old hub\n", want: []gossh.PublicKey{key1}},
+		{name: "several keys", data: line1 + "\n" + line2 + "\n", want: []gossh.PublicKey{key1, key2}},
+		{name: "comments and blank lines", data: "# current hub\n\n" + line1 + "\n  \n# next hub\n" + line2, want: []gossh.PublicKey{key1, key2}},
+		{name: "windows line endings", data: line1 + "\r\n" + line2 + "\r\n", want: []gossh.PublicKey{key1, key2}},
+		{name: "options", data: `from="10.0.0.1" ` + line1, want: []gossh.PublicKey{key1}},
+		{name: "invalid key", data: line1 + "\nssh-ed25519 AAAAinvalid\n", wantErr: "line 2"},
+		{name: "empty", data: "", wantErr: "no keys found"},
+		{name: "only comments", data: "# no keys\n", wantErr: "no keys found"},
+	}
+	for _, tt := range tests {
+		keys, err := parseAuthorizedKeys([]byte(tt.data))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(keys) != len(tt.want) {
+			t.Errorf("%s: got %d keys, want %d", tt.name, len(keys), len(tt.want))
+			continue
+		}
+		for i := range keys {
+			if string(keys[i].Marshal()) != string(tt.want[i].Marshal()) {
+				t.Errorf("%s: key %d differs", tt.name, i)
+			}
+		}
+	}
+}
+
+func TestAuthorizedKeysReload(t *testing.T) {
+	key1, line1 := testAuthorizedKey(t)
+	key2, line2 := testAuthorizedKey(t)
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(line1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KEY", "")
+	t.Setenv("KEY_FILE", path)
+
+	ak := &authorizedKeys{}
+	ak.reload()
+	if !ak.isAuthorized(key1) || ak.isAuthorized(key2) {
+		t.Fatal("expected only the first key after loading the file")
+	}
+
+	// both keys are valid during a rotation
+	if err := os.WriteFile(path, []byte(line1+"\n"+line2+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ak.reload()
+	if !ak.isAuthorized(key1) || !ak.isAuthorized(key2) {
+		t.Error("expected both keys after adding the second key")
+	}
+
+	// an invalid file keeps the current keys
+	if err := os.WriteFile(path, []byte("not a key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ak.reload()
+	if !ak.isAuthorized(key1) || !ak.isAuthorized(key2) {
+		t.Error("expected the keys to be kept after an invalid reload")
+	}
+
+	// KEY takes precedence over KEY_FILE
+	t.Setenv("KEY", line2)
+	ak.reload()
+	if ak.isAuthorized(key1) || !ak.isAuthorized(key2) {
+		t.Error("expected only the key from KEY")
+	}
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"beszel/internal/entities/vm"
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Domain states from virDomainState
+var domainStates = map[int]string{
+	0: "nostate",
+	1: "running",
+	2: "blocked",
+	3: "paused",
+	4: "shutdown",
+	5: "shutoff",
+	6: "crashed",
+	7: "pmsuspended",
+}
+
+type libvirtManager struct {
+	sync.Mutex
+	uri      string                    // libvirt connection URI
+	numCpu   float64                   // Number of host CPUs, used to calculate CPU percent
+	previous map[string]domainCounters // Counters from the previous poll, keyed by domain name
+}
+
+// Cumulative counters of a domain read from virsh domstats
+type domainCounters struct {
+	time      time.Time
+	cpuTime   uint64 // Nanoseconds
+	diskRead  uint64 // Bytes
+	diskWrite uint64
+	netSent   uint64
+	netRecv   uint64
+}
+
+// Raw values of a domain parsed from virsh domstats
+type domainStats struct {
+	name     string
+	state    int
+	vcpus    int
+	memKiB   uint64
+	counters domainCounters
+}
+
+// Creates a libvirt manager if virsh is installed and can connect to the
+// LIBVIRT_URI (default qemu:///system). Returns nil otherwise.
+func newLibvirtManager() *libvirtManager {
+	if _, err := exec.LookPath("virsh"); err != nil {
+		return nil
+	}
+	lm := &libvirtManager{
+		uri:      "qemu:///system",
+		numCpu:   float64(runtime.NumCPU()),
+		previous: make(map[string]domainCounters),
+	}
+	if uri, exists := LookupEnv("LIBVIRT_URI"); exists {
+		lm.uri = uri
+	}
+	if _, err := lm.virsh("uri"); err != nil {
+		slog.Debug("Not monitoring libvirt", "uri", lm.uri, "err", err)
+		return nil
+	}
+	slog.Info("Monitoring libvirt domains", "uri", lm.uri)
+	return lm
+}
+
+// Runs a read-only virsh command
+func (lm *libvirtManager) virsh(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	args = append([]string{"--readonly", "--connect", lm.uri}, args...)
+	return exec.CommandContext(ctx, "virsh", args...).Output()
+}
+
+// Returns stats for all domains. Rates are calculated from the previous poll,
+// so they're zero the first time a domain is seen.
+func (lm *libvirtManager) getVmStats() ([]*vm.Stats, error) {
+	output, err := lm.virsh("domstats", "--raw", "--state", "--cpu-total", "--balloon", "--vcpu", "--interface", "--block")
+	if err != nil {
+		return nil, err
+	}
+	domains := parseDomstats(output)
+
+	lm.Lock()
+	defer lm.Unlock()
+
+	stats := make([]*vm.Stats, 0, len(domains))
+	current := make(map[string]domainCounters, len(domains))
+	for _, d := range domains {
+		s := &vm.Stats{
+			Name:  d.name,
+			Vcpus: d.vcpus,
+			Mem:   bytesToMegabytes(float64(d.memKiB) * 1024),
+			State: domainStates[d.state],
+		}
+		current[d.name] = d.counters
+		if prev, ok := lm.previous[d.name]; ok {
+			elapsed := d.counters.time.Sub(prev.time).Seconds()
+			if elapsed > 0 {
+				s.Cpu = twoDecimals(float64(delta(d.counters.cpuTime, prev.cpuTime)) / (elapsed * 1e9 * lm.numCpu) * 100)
+				s.DiskRead = bytesToMegabytes(float64(delta(d.counters.diskRead, prev.diskRead)) / elapsed)
+				s.DiskWrite = bytesToMegabytes(float64(delta(d.counters.diskWrite, prev.diskWrite)) / elapsed)
+				s.NetworkSent = bytesToMegabytes(float64(delta(d.counters.netSent, prev.netSent)) / elapsed)
+				s.NetworkRecv = bytesToMegabytes(float64(delta(d.counters.netRecv, prev.netRecv)) / elapsed)
+			}
+		}
+		stats = append(stats, s)
+	}
+	// forget domains that no longer exist
+	lm.previous = current
+	return stats, nil
+}
+
+// Returns the increase of a counter, or zero if it was reset (e.g. domain restarted)
+func delta(current, previous uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// Parses `virsh domstats --raw` output:
+//
+//	Domain: 'web'
+//	  state.state=1
+//	  cpu.time=123456789
+//	  net.0.rx.bytes=1024
+func parseDomstats(output []byte) []domainStats {
+	var domains []domainStats
+	var d *domainStats
+	now := time.Now()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, found := strings.CutPrefix(line, "Domain: "); found {
+			domains = append(domains, domainStats{name: strings.Trim(name, "'\"")})
+			d = &domains[len(domains)-1]
+			d.counters.time = now
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || d == nil {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		parts := strings.Split(key, ".")
+		switch {
+		case key == "state.state":
+			d.state = int(n)
+		case key == "cpu.time":
+			d.counters.cpuTime = n
+		case key == "vcpu.current":
+			d.vcpus = int(n)
+		case key == "balloon.rss":
+			// resident memory on the host, preferred over the guest's balloon size
+			d.memKiB = n
+		case key == "balloon.current":
+			if d.memKiB == 0 {
+				d.memKiB = n
+			}
+		case len(parts) == 4 && parts[0] == "net" && parts[3] == "bytes":
+			// libvirt reports rx / tx from the guest's point of view
+			if parts[2] == "rx" {
+				d.counters.netRecv += n
+			} else if parts[2] == "tx" {
+				d.counters.netSent += n
+			}
+		case len(parts) == 4 && parts[0] == "block" && parts[3] == "bytes":
+			if parts[2] == "rd" {
+				d.counters.diskRead += n
+			} else if parts[2] == "wr" {
+				d.counters.diskWrite += n
+			}
+		}
+	}
+	return domains
+}
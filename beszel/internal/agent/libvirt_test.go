@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"beszel/internal/entities/vm"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Output of `virsh domstats --raw --state --cpu-total --balloon --vcpu --interface --block`
+// for a running domain with two disks and a stopped domain
+const testDomstats = `Domain: 'web'
+  state.state=1
+  state.reason=1
+  cpu.time=48261234567
+  cpu.user=30000000000
+  cpu.system=12000000000
+  balloon.current=2097152
+  balloon.maximum=2097152
+  balloon.rss=1534112
+  vcpu.current=2
+  vcpu.maximum=2
+  vcpu.0.state=1
+  vcpu.0.time=20000000000
+  net.count=1
+  net.0.name=vnet0
+  net.0.rx.bytes=104857600
+  net.0.rx.pkts=80000
+  net.0.tx.bytes=52428800
+  net.0.tx.pkts=40000
+  block.count=2
+  block.0.name=vda
+  block.0.path=/var/lib/libvirt/images/web.qcow2
+  block.0.rd.reqs=1000
+  block.0.rd.bytes=209715200
+  block.0.wr.reqs=500
+  block.0.wr.bytes=104857600
+  block.1.name=sda
+  block.1.rd.bytes=1048576
+  block.1.wr.bytes=0
+
+Domain: 'db'
+  state.state=5
+  state.reason=1
+  balloon.current=4194304
+  balloon.maximum=4194304
+  vcpu.current=4
+  vcpu.maximum=4
+
+`
+
+func TestParseDomstats(t *testing.T) {
+	domains := parseDomstats([]byte(testDomstats))
+	want := []domainStats{
+		{
+			name:   "web",
+			state:  1,
+			vcpus:  2,
+			memKiB: 1534112,
+			counters: domainCounters{
+				cpuTime:   48261234567,
+				diskRead:  209715200 + 1048576,
+				diskWrite: 104857600,
+				netSent:   52428800,
+				netRecv:   104857600,
+			},
+		},
+		{name: "db", state: 5, vcpus: 4, memKiB: 4194304},
+	}
+	if len(domains) != len(want) {
+		t.Fatalf("got %d domains, want %d", len(domains), len(want))
+	}
+	for i := range want {
+		// times are set when parsing
+		domains[i].counters.time = time.Time{}
+		if domains[i] != want[i] {
+			t.Errorf("got %+v, want %+v", domains[i], want[i])
+		}
+	}
+}
+
+func TestParseDomstatsIgnoresInvalidLines(t *testing.T) {
+	output := "state.state=1\nDomain: \"vm\"\n  cpu.time=abc\n  vcpu.current=1\n  garbage\n"
+	domains := parseDomstats([]byte(output))
+	if len(domains) != 1 || domains[0].name != "vm" || domains[0].vcpus != 1 || domains[0].counters.cpuTime != 0 {
+		t.Errorf("got %+v", domains)
+	}
+}
+
+// Calculates rates from recorded output returned by a fake virsh on the PATH
+func TestGetVmStats(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake virsh is a shell script")
+	}
+	dir := t.TempDir()
+	output := filepath.Join(dir, "domstats")
+	script := "#!/bin/sh\ncat \"" + output + "\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "virsh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err := os.WriteFile(output, []byte(testDomstats), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lm := &libvirtManager{uri: "test:///default", numCpu: 4, previous: make(map[string]domainCounters)}
+	stats, err := lm.getVmStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rates are zero the first time a domain is seen
+	want := []vm.Stats{
+		{Name: "web", Vcpus: 2, Mem: 1498.16, State: "running"},
+		{Name: "db", Vcpus: 4, Mem: 4096, State: "shutoff"},
+	}
+	compareVmStats(t, stats, want)
+
+	// 100 seconds later: 200s of cpu time on 4 cpus, 100 MB read, 50 MB written,
+	// 200 MB received and 10 MB sent. The db domain was removed.
+	for name, counters := range lm.previous {
+		counters.time = counters.time.Add(-100 * time.Second)
+		lm.previous[name] = counters
+	}
+	second := strings.NewReplacer(
+		"cpu.time=48261234567", "cpu.time=248261234567",
+		"block.0.rd.bytes=209715200", "block.0.rd.bytes=314572800",
+		"block.0.wr.bytes=104857600", "block.0.wr.bytes=157286400",
+		"net.0.rx.bytes=104857600", "net.0.rx.bytes=314572800",
+		"net.0.tx.bytes=52428800", "net.0.tx.bytes=62914560",
+	).Replace(testDomstats[:strings.Index(testDomstats, "Domain: 'db'")])
+	if err := os.WriteFile(output, []byte(second), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = lm.getVmStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []vm.Stats{
+		{Name: "web", Vcpus: 2, Mem: 1498.16, State: "running", Cpu: 50, DiskRead: 1, DiskWrite: 0.5, NetworkSent: 0.1, NetworkRecv: 2},
+	}
+	compareVmStats(t, stats, want)
+	if _, exists := lm.previous["db"]; exists {
+		t.Error("removed domain is still tracked")
+	}
+}
+
+func compareVmStats(t *testing.T, got []*vm.Stats, want []vm.Stats) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d domains, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("got %+v, want %+v", *got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Maximum length of the last matched line sent to the hub
+const maxLogLineLength = 500
+
+type logWatcher struct {
+	sync.Mutex
+	files    []*watchedFile // Files being followed
+	patterns []*logPattern  // All patterns, in config order
+}
+
+type watchedFile struct {
+	path     string
+	file     *os.File
+	info     os.FileInfo   // Info of the open file, used to detect rotation
+	offset   int64         // Read position in the open file
+	partial  []byte        // Incomplete last line from the previous read
+	patterns []*logPattern // Patterns matched against lines of this file
+}
+
+type logPattern struct {
+	name     string
+	re       *regexp.Regexp
+	count    int    // Matching lines since the last poll
+	lastLine string // Last matching line
+}
+
+// Creates a log watcher from the LOG_WATCH environment variable.
+// Format: name=path:regex entries separated by semicolons. Example:
+// LOG_WATCH="oom=/var/log/kern.log:Out of memory|oom-killer;errors=/var/log/app.log:ERROR"
+func newLogWatcher(watchEnv string) (*logWatcher, error) {
+	lw := &logWatcher{}
+	files := make(map[string]*watchedFile)
+	for _, entry := range strings.Split(watchEnv, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid log watch: %s", entry)
+		}
+		path, expr, ok := strings.Cut(rest, ":")
+		if !ok || path == "" || expr == "" {
+			return nil, fmt.Errorf("invalid log watch: %s", entry)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for %s: %w", name, err)
+		}
+		pattern := &logPattern{name: strings.TrimSpace(name), re: re}
+		lw.patterns = append(lw.patterns, pattern)
+
+		wf, exists := files[path]
+		if !exists {
+			wf = &watchedFile{path: path}
+			// start at the end of existing files so old lines aren't counted
+			if err := wf.open(true); err != nil {
+				slog.Warn("Log file not found, waiting for it to be created", "path", path)
+			}
+			files[path] = wf
+			lw.files = append(lw.files, wf)
+		}
+		wf.patterns = append(wf.patterns, pattern)
+		slog.Info("Watching log file", "name", pattern.name, "path", path, "pattern", expr)
+	}
+	return lw, nil
+}
+
+// Reads new lines from all files and returns match counts since the last call
+func (lw *logWatcher) collect() map[string]system.LogMatch {
+	lw.Lock()
+	defer lw.Unlock()
+
+	for _, wf := range lw.files {
+		if err := wf.poll(); err != nil {
+			slog.Debug("Error reading log file", "path", wf.path, "err", err)
+		}
+	}
+
+	matches := make(map[string]system.LogMatch, len(lw.patterns))
+	for _, p := range lw.patterns {
+		matches[p.name] = system.LogMatch{Count: float64(p.count), LastLine: p.lastLine}
+		p.count = 0
+	}
+	return matches
+}
+
+// Opens the file, optionally seeking to the end
+func (wf *watchedFile) open(seekEnd bool) error {
+	file, err := os.Open(wf.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	wf.file, wf.info, wf.offset, wf.partial = file, info, 0, nil
+	if seekEnd {
+		wf.offset, err = file.Seek(0, io.SeekEnd)
+	}
+	return err
+}
+
+// Reads lines added since the last poll, following rotation and truncation
+func (wf *watchedFile) poll() error {
+	// file didn't exist at the last poll
+	if wf.file == nil {
+		if err := wf.open(false); err != nil {
+			return err
+		}
+		return wf.read()
+	}
+
+	info, err := os.Stat(wf.path)
+	switch {
+	case err == nil && !os.SameFile(info, wf.info):
+		// rotated: finish reading the old file, then switch to the new one
+		if err := wf.read(); err != nil {
+			return err
+		}
+		wf.flushPartial()
+		wf.file.Close()
+		if err := wf.open(false); err != nil {
+			wf.file = nil
+			return err
+		}
+	case err == nil && info.Size() < wf.offset:
+		// truncated in place (copytruncate)
+		if _, err := wf.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		wf.offset, wf.partial = 0, nil
+	}
+	return wf.read()
+}
+
+// Reads from the current offset to the end of the file and matches complete lines
+func (wf *watchedFile) read() error {
+	data, err := io.ReadAll(wf.file)
+	if err != nil {
+		return err
+	}
+	wf.offset += int64(len(data))
+	if len(wf.partial) > 0 {
+		data = append(wf.partial, data...)
+		wf.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		wf.match(data[:i])
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		wf.partial = bytes.Clone(data)
+	}
+	return nil
+}
+
+// Matches the incomplete last line of a rotated file
+func (wf *watchedFile) flushPartial() {
+	if len(wf.partial) > 0 {
+		wf.match(wf.partial)
+		wf.partial = nil
+	}
+}
+
+// Matches a line against the file's patterns
+func (wf *watchedFile) match(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	for _, p := range wf.patterns {
+		if p.re.Match(line) {
+			p.count++
+			p.lastLine = string(line[:min(len(line), maxLogLineLength)])
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"beszel/internal/entities/container"
+	"bufio"
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lxcManager struct {
+	sync.Mutex
+	root     string                 // cgroup mount point
+	unified  bool                   // True for cgroup v2
+	numCpu   float64                // Number of host CPUs, used to calculate CPU percent
+	previous map[string]lxcCounters // Counters from the previous poll, keyed by cgroup
+}
+
+type lxcContainer struct {
+	id     string // Container name or Proxmox VMID
+	cgroup string // Path relative to the cgroup root (v2) or controller root (v1)
+}
+
+// Cumulative counters of a container
+type lxcCounters struct {
+	time      time.Time
+	cpu       uint64 // Nanoseconds
+	diskRead  uint64 // Bytes
+	diskWrite uint64
+	netSent   uint64
+	netRecv   uint64
+}
+
+// Creates an LXC manager if the cgroup hierarchy exists. Containers are looked
+// up on each poll, so containers started after the agent are picked up.
+// Containers are found under lxc.payload.<name> (LXC 4+) or lxc/<name> (Proxmox,
+// older LXC). Network stats are read from the namespace of a process in the
+// container, so the agent must share the host's PID namespace.
+func newLxcManager() *lxcManager {
+	lm := &lxcManager{
+		root:     "/sys/fs/cgroup",
+		numCpu:   float64(runtime.NumCPU()),
+		previous: make(map[string]lxcCounters),
+	}
+	if root, exists := LookupEnv("CGROUP_ROOT"); exists {
+		lm.root = root
+	}
+	if _, err := os.Stat(filepath.Join(lm.root, "cgroup.controllers")); err == nil {
+		lm.unified = true
+	}
+	if _, err := os.Stat(lm.containersDir()); err != nil {
+		slog.Debug("Not monitoring LXC containers", "err", err)
+		return nil
+	}
+	if len(lm.findContainers()) == 0 {
+		slog.Debug("No LXC containers found", "cgroup", lm.root, "v2", lm.unified)
+	} else {
+		slog.Info("Monitoring LXC containers", "cgroup", lm.root, "v2", lm.unified)
+	}
+	return lm
+}
+
+// Returns the directory of a controller for a container cgroup.
+// All controllers share one directory in cgroup v2.
+func (lm *lxcManager) path(controller, cgroup string) string {
+	if lm.unified {
+		return filepath.Join(lm.root, cgroup)
+	}
+	return filepath.Join(lm.root, controller, cgroup)
+}
+
+// Returns the directory containing container cgroups
+func (lm *lxcManager) containersDir() string {
+	if lm.unified {
+		return lm.root
+	}
+	return filepath.Join(lm.root, "cpuacct")
+}
+
+// Lists running containers from the cgroup hierarchy
+func (lm *lxcManager) findContainers() []lxcContainer {
+	base := lm.containersDir()
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil
+	}
+	var containers []lxcContainer
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if id, found := strings.CutPrefix(name, "lxc.payload."); found {
+			containers = append(containers, lxcContainer{id: id, cgroup: name})
+			continue
+		}
+		if name != "lxc" {
+			continue
+		}
+		children, err := os.ReadDir(filepath.Join(base, name))
+		if err != nil {
+			continue
+		}
+		for _, child := range children {
+			if child.IsDir() {
+				containers = append(containers, lxcContainer{id: child.Name(), cgroup: filepath.Join(name, child.Name())})
+			}
+		}
+	}
+	return containers
+}
+
+// Returns stats for all running containers. Rates are calculated from the
+// previous poll, so they're zero the first time a container is seen.
+func (lm *lxcManager) getLxcStats() []*container.Stats {
+	lm.Lock()
+	defer lm.Unlock()
+
+	containers := lm.findContainers()
+	stats := make([]*container.Stats, 0, len(containers))
+	current := make(map[string]lxcCounters, len(containers))
+	for _, ctr := range containers {
+		counters, err := lm.readCounters(ctr.cgroup)
+		if err != nil {
+			slog.Debug("Error reading LXC container stats", "container", ctr.id, "err", err)
+			continue
+		}
+		current[ctr.cgroup] = counters
+
+		s := &container.Stats{
+			Name: lxcName(ctr.id),
+			Mem:  bytesToMegabytes(float64(lm.readMemory(ctr.cgroup))),
+		}
+		if prev, ok := lm.previous[ctr.cgroup]; ok {
+			elapsed := counters.time.Sub(prev.time).Seconds()
+			if elapsed > 0 {
+				s.Cpu = twoDecimals(float64(delta(counters.cpu, prev.cpu)) / (elapsed * 1e9 * lm.numCpu) * 100)
+				s.DiskRead = bytesToMegabytes(float64(delta(counters.diskRead, prev.diskRead)) / elapsed)
+				s.DiskWrite = bytesToMegabytes(float64(delta(counters.diskWrite, prev.diskWrite)) / elapsed)
+				s.NetworkSent = bytesToMegabytes(float64(delta(counters.netSent, prev.netSent)) / elapsed)
+				s.NetworkRecv = bytesToMegabytes(float64(delta(counters.netRecv, prev.netRecv)) / elapsed)
+			}
+		}
+		stats = append(stats, s)
+	}
+	lm.previous = current
+	return stats
+}
+
+// Reads cumulative cpu, disk and network counters of a container cgroup
+func (lm *lxcManager) readCounters(cgroup string) (lxcCounters, error) {
+	counters := lxcCounters{time: time.Now()}
+	if lm.unified {
+		data, err := os.ReadFile(filepath.Join(lm.path("cpu", cgroup), "cpu.stat"))
+		if err != nil {
+			return counters, err
+		}
+		counters.cpu = readKeyedValue(data, "usage_usec") * 1000
+		if data, err := os.ReadFile(filepath.Join(lm.path("io", cgroup), "io.stat")); err == nil {
+			counters.diskRead, counters.diskWrite = parseIoStat(data)
+		}
+	} else {
+		data, err := os.ReadFile(filepath.Join(lm.path("cpuacct", cgroup), "cpuacct.usage"))
+		if err != nil {
+			return counters, err
+		}
+		counters.cpu, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if data, err := os.ReadFile(filepath.Join(lm.path("blkio", cgroup), "blkio.throttle.io_service_bytes")); err == nil {
+			counters.diskRead, counters.diskWrite = parseBlkioServiceBytes(data)
+		}
+	}
+	if pid := lm.findPid(cgroup); pid != "" {
+		counters.netSent, counters.netRecv = readNetDev(pid)
+	}
+	return counters, nil
+}
+
+// Returns memory used by a container, excluding inactive page cache
+func (lm *lxcManager) readMemory(cgroup string) uint64 {
+	dir := lm.path("memory", cgroup)
+	usageFile, statKey := "memory.current", "inactive_file"
+	if !lm.unified {
+		usageFile, statKey = "memory.usage_in_bytes", "total_inactive_file"
+	}
+	data, err := os.ReadFile(filepath.Join(dir, usageFile))
+	if err != nil {
+		return 0
+	}
+	usage, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if stat, err := os.ReadFile(filepath.Join(dir, "memory.stat")); err == nil {
+		usage -= min(usage, readKeyedValue(stat, statKey))
+	}
+	return usage
+}
+
+// Returns the first process found in the container cgroup or its children
+func (lm *lxcManager) findPid(cgroup string) string {
+	var pid string
+	filepath.WalkDir(lm.path("cpuacct", cgroup), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || pid != "" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Name() == "cgroup.procs" {
+			if data, err := os.ReadFile(path); err == nil {
+				if first, _, _ := strings.Cut(string(data), "\n"); first != "" {
+					pid = strings.TrimSpace(first)
+					return filepath.SkipAll
+				}
+			}
+		}
+		return nil
+	})
+	return pid
+}
+
+// Returns the value of a key in a "key value" file such as cpu.stat or memory.stat
+func readKeyedValue(data []byte, key string) uint64 {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if k, v, found := strings.Cut(scanner.Text(), " "); found && k == key {
+			n, _ := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// Sums read and written bytes from io.stat: "8:0 rbytes=1 wbytes=2 rios=3 ..."
+func parseIoStat(data []byte) (read, write uint64) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+	return read, write
+}
+
+// Sums read and written bytes from blkio.throttle.io_service_bytes: "8:0 Read 123"
+func parseBlkioServiceBytes(data []byte) (read, write uint64) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			read += n
+		case "Write":
+			write += n
+		}
+	}
+	return read, write
+}
+
+// Sums sent and received bytes of non-loopback interfaces in the network
+// namespace of a process
+func readNetDev(pid string) (sent, recv uint64) {
+	data, err := os.ReadFile(filepath.Join("/proc", pid, "net", "dev"))
+	if err != nil {
+		return 0, 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		iface, counters, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		// receive bytes is the first field, transmit bytes the ninth
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		s, _ := strconv.ParseUint(fields[8], 10, 64)
+		recv += r
+		sent += s
+	}
+	return sent, recv
+}
+
+// Returns the hostname from the Proxmox container config, or the id if not found
+func lxcName(id string) string {
+	data, err := os.ReadFile(filepath.Join("/etc/pve/lxc", id+".conf"))
+	if err != nil {
+		return id
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// snapshot sections follow the current config
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if hostname, found := strings.CutPrefix(line, "hostname:"); found {
+			return strings.TrimSpace(hostname)
+		}
+	}
+	return id
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	sshServer "github.com/gliderlabs/ssh"
+	"golang.org/x/net/websocket"
+)
+
+// Maximum delay between reconnection attempts
+const maxReconnectDelay = time.Minute
+
+// Path of the hub endpoint accepting agent connections
+const agentConnectPath = "/api/beszel/agent-connect"
+
+// Connects to the hub at HUB_URL over a WebSocket and serves SSH over it, so
+// the hub can poll agents that don't accept incoming connections (e.g. behind NAT).
+// The agent identifies itself with the system's TOKEN, and the hub still
+// authenticates with its SSH key. Reconnects with backoff when the connection drops.
+func (a *Agent) connectToHub(server *sshServer.Server, hubUrl, token string) {
+	location, err := websocketUrl(hubUrl)
+	if err != nil {
+		slog.Error("HUB_URL", "err", err)
+		os.Exit(1)
+	}
+	delay := time.Second
+	for {
+		connected, err := a.serveHubConnection(server, location, token)
+		if connected {
+			delay = time.Second
+		}
+		slog.Warn("Disconnected from hub", "url", hubUrl, "err", err, "retry", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// Opens a WebSocket connection to the hub and serves SSH until it closes.
+// Returns true if the connection was established.
+func (a *Agent) serveHubConnection(server *sshServer.Server, location, token string) (bool, error) {
+	config, err := websocket.NewConfig(location, location)
+	if err != nil {
+		return false, err
+	}
+	config.Header = http.Header{"X-Token": []string{token}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := config.DialContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	conn.PayloadType = websocket.BinaryFrame
+	slog.Info("Connected to hub", "url", location)
+	// blocks until the connection is closed
+	server.HandleConn(conn)
+	return true, fmt.Errorf("connection closed")
+}
+
+// Converts the hub URL to the WebSocket URL of the agent endpoint
+func websocketUrl(hubUrl string) (string, error) {
+	u, err := url.Parse(hubUrl)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid scheme: %s", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + agentConnectPath
+	return u.String(), nil
+}
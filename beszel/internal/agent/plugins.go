@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type pluginManager struct {
+	dir     string        // Directory containing plugin executables
+	timeout time.Duration // Maximum run time of a plugin
+}
+
+// Creates a plugin manager for the PLUGIN_DIR directory.
+// Each executable in the directory is run on every poll and must print a JSON
+// object of numeric metrics, e.g. {"queue_depth": 12, "errors": 3}. Metrics are
+// namespaced by the plugin file name, e.g. "queue.queue_depth".
+func newPluginManager(dir string) (*pluginManager, error) {
+	pm := &pluginManager{dir: dir, timeout: 3 * time.Second}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if t, set := LookupEnv("PLUGIN_TIMEOUT"); set {
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, err
+		}
+		pm.timeout = timeout
+	}
+	slog.Info("PLUGIN_DIR", "dir", dir, "timeout", pm.timeout)
+	return pm, nil
+}
+
+// Runs all plugins concurrently and returns their combined metrics
+func (pm *pluginManager) collect() map[string]float64 {
+	plugins := pm.findPlugins()
+	if len(plugins) == 0 {
+		return nil
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	metrics := make(map[string]float64)
+	for _, path := range plugins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := pm.runPlugin(path)
+			if err != nil {
+				slog.Error("Plugin error", "plugin", path, "err", err)
+				return
+			}
+			namespace := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			mutex.Lock()
+			defer mutex.Unlock()
+			for key, value := range values {
+				metrics[namespace+"."+key] = twoDecimals(value)
+			}
+		}()
+	}
+	wg.Wait()
+	return metrics
+}
+
+// Returns paths of executable files in the plugin directory.
+// The directory is read on every poll so plugins can be added without a restart.
+func (pm *pluginManager) findPlugins() []string {
+	entries, err := os.ReadDir(pm.dir)
+	if err != nil {
+		slog.Error("Error reading plugin dir", "err", err)
+		return nil
+	}
+	var plugins []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(pm.dir, entry.Name())
+		// follow symlinks
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		plugins = append(plugins, path)
+	}
+	return plugins
+}
+
+// Runs a plugin and parses its output
+func (pm *pluginManager) runPlugin(path string) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pm.timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = pm.dir
+	cmd.Stdout = &stdout
+	// don't wait on child processes holding stdout open after the plugin is killed
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %v", pm.timeout)
+		}
+		return nil, err
+	}
+	return parsePluginOutput(stdout.Bytes())
+}
+
+// Parses a JSON object of metrics. Values may be numbers, numeric strings or booleans.
+func parsePluginOutput(output []byte) (map[string]float64, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]float64, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case float64:
+			metrics[key] = v
+		case bool:
+			if v {
+				metrics[key] = 1
+			} else {
+				metrics[key] = 0
+			}
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				metrics[key] = f
+			}
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	psutilNet "github.com/shirou/gopsutil/v4/net"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// Returns listening TCP sockets and bound UDP sockets with the owning process name.
+// Sockets shared by several processes (e.g. forked workers) are reported once.
+// UDP sockets on ephemeral ports are skipped, they're usually clients (e.g. DNS
+// lookups) rather than services.
+func getListeningPorts() ([]system.ListeningPort, error) {
+	conns, err := psutilNet.ConnectionsWithoutUids("inet")
+	if err != nil {
+		return nil, err
+	}
+	ephemeralLow, ephemeralHigh := ephemeralPortRange()
+	seen := make(map[string]struct{})
+	names := make(map[int32]string)
+	// empty rather than nil so the hub can tell that no ports are listening
+	ports := []system.ListeningPort{}
+	for _, conn := range conns {
+		var protocol string
+		switch {
+		case conn.Type == syscall.SOCK_STREAM && conn.Status == "LISTEN":
+			protocol = "tcp"
+		case conn.Type == syscall.SOCK_DGRAM && conn.Raddr.Port == 0:
+			if conn.Laddr.Port >= ephemeralLow && conn.Laddr.Port <= ephemeralHigh {
+				continue
+			}
+			protocol = "udp"
+		default:
+			continue
+		}
+		if conn.Family == syscall.AF_INET6 {
+			protocol += "6"
+		}
+		key := protocol + " " + conn.Laddr.IP + " " + strconv.Itoa(int(conn.Laddr.Port))
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		port := system.ListeningPort{
+			Protocol: protocol,
+			Address:  conn.Laddr.IP,
+			Port:     conn.Laddr.Port,
+		}
+		if conn.Pid > 0 {
+			name, ok := names[conn.Pid]
+			if !ok {
+				if p, err := process.NewProcess(conn.Pid); err == nil {
+					name, _ = p.Name()
+				}
+				names[conn.Pid] = name
+			}
+			port.Process = name
+		}
+		ports = append(ports, port)
+	}
+	slices.SortFunc(ports, func(a, b system.ListeningPort) int {
+		return cmp.Or(
+			cmp.Compare(a.Port, b.Port),
+			cmp.Compare(a.Protocol, b.Protocol),
+			cmp.Compare(a.Address, b.Address),
+		)
+	})
+	slog.Debug("Listening ports", "count", len(ports))
+	return ports, nil
+}
+
+// Returns the range of ports the system assigns to sockets that aren't bound
+// to a specific port, falling back to the default range of the OS
+func ephemeralPortRange() (uint32, uint32) {
+	if runtime.GOOS != "linux" {
+		return 49152, 65535
+	}
+	if data, err := os.ReadFile("/proc/sys/net/ipv4/ip_local_port_range"); err == nil {
+		if low, high, ok := parsePortRange(string(data)); ok {
+			return low, high
+		}
+	}
+	return 32768, 60999
+}
+
+// Parses a port range in the format of ip_local_port_range ("32768\t60999")
+func parsePortRange(s string) (uint32, uint32, bool) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	low, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	high, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil || high < low {
+		return 0, 0, false
+	}
+	return uint32(low), uint32(high), true
+}
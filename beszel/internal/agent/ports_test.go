@@ -0,0 +1,27 @@
+package agent
+
+import "testing"
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		input     string
+		low, high uint32
+		ok        bool
+	}{
+		{input: "32768\t60999\n", low: 32768, high: 60999, ok: true},
+		{input: "1024 65535", low: 1024, high: 65535, ok: true},
+		{input: "40000 40000", low: 40000, high: 40000, ok: true},
+		{input: "60999 32768", ok: false},
+		{input: "32768", ok: false},
+		{input: "1 2 3", ok: false},
+		{input: "a 60999", ok: false},
+		{input: "32768 70000", ok: false},
+		{input: "", ok: false},
+	}
+	for _, tt := range tests {
+		low, high, ok := parsePortRange(tt.input)
+		if ok != tt.ok || low != tt.low || high != tt.high {
+			t.Errorf("%q: got %d %d %v, want %d %d %v", tt.input, low, high, ok, tt.low, tt.high, tt.ok)
+		}
+	}
+}
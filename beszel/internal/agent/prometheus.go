@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type prometheusManager struct {
+	targets  []prometheusTarget     // Exporters to scrape
+	allowed  []string               // Allowed metric names (may contain * wildcards)
+	client   *http.Client           // Client used for scraping
+	counters map[string]counterPrev // Previous counter values used to calculate rates
+	mutex    sync.Mutex             // Protects counters
+}
+
+type prometheusTarget struct {
+	name string // Namespace for the metrics
+	url  string // URL of the /metrics endpoint
+}
+
+type counterPrev struct {
+	value  float64
+	time   time.Time
+	target string // Name of the target the counter was scraped from
+}
+
+// A single sample parsed from the text exposition format
+type promSample struct {
+	name    string // Metric name
+	labels  string // Label set in canonical form, e.g. {code="200",method="get"}
+	value   float64
+	counter bool // True for counters, which are sent as per second rates
+}
+
+// Creates a prometheus manager from the PROMETHEUS environment variable.
+// Format: name=url pairs separated by commas. Metrics are filtered by the
+// PROMETHEUS_METRICS allow-list (comma separated, * wildcards allowed). Example:
+// PROMETHEUS="app=http://127.0.0.1:8080/metrics" PROMETHEUS_METRICS="http_requests_total,queue_*"
+func newPrometheusManager(targetsEnv string) (*prometheusManager, error) {
+	pm := &prometheusManager{
+		client:   &http.Client{Timeout: 2 * time.Second},
+		counters: make(map[string]counterPrev),
+	}
+	for _, entry := range strings.Split(targetsEnv, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, url, found := strings.Cut(entry, "=")
+		if !found || !strings.HasPrefix(url, "http") {
+			return nil, fmt.Errorf("invalid prometheus target: %s", entry)
+		}
+		slog.Info("Prometheus target", "name", name, "url", url)
+		pm.targets = append(pm.targets, prometheusTarget{name: name, url: url})
+	}
+	allowed, exists := LookupEnv("PROMETHEUS_METRICS")
+	if !exists || allowed == "" {
+		return nil, fmt.Errorf("PROMETHEUS_METRICS must be set")
+	}
+	for _, name := range strings.Split(allowed, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			pm.allowed = append(pm.allowed, name)
+		}
+	}
+	return pm, nil
+}
+
+// Scrapes all targets and returns the selected metrics.
+// Gauges are returned as is, counters as per second rates since the previous scrape.
+// Counters missing from a target's scrape are forgotten.
+func (pm *prometheusManager) collect() map[string]float64 {
+	metrics := make(map[string]float64)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range pm.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			samples, err := pm.scrape(target.url)
+			if err != nil {
+				slog.Error("Error scraping prometheus target", "name", target.name, "err", err)
+				return
+			}
+			now := time.Now()
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, sample := range samples {
+				key := target.name + "." + sample.name + sample.labels
+				if !sample.counter {
+					metrics[key] = twoDecimals(sample.value)
+				} else if rate, ok := pm.counterRate(target.name, key, sample.value, now); ok {
+					metrics[key] = twoDecimals(rate)
+				}
+			}
+			pm.pruneCounters(target.name, now)
+		}()
+	}
+	wg.Wait()
+	return metrics
+}
+
+// Returns the per second rate of a counter since the previous call.
+// Returns false on the first sample and after counter resets.
+func (pm *prometheusManager) counterRate(target, key string, value float64, now time.Time) (float64, bool) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	prev, exists := pm.counters[key]
+	pm.counters[key] = counterPrev{value: value, time: now, target: target}
+	if !exists || value < prev.value {
+		return 0, false
+	}
+	elapsed := now.Sub(prev.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return (value - prev.value) / elapsed, true
+}
+
+// Removes the target's counters that weren't updated by the scrape at now
+func (pm *prometheusManager) pruneCounters(target string, now time.Time) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	for key, prev := range pm.counters {
+		if prev.target == target && prev.time.Before(now) {
+			delete(pm.counters, key)
+		}
+	}
+}
+
+// Fetches and parses a metrics endpoint, returning only allowed metrics
+func (pm *prometheusManager) scrape(url string) ([]promSample, error) {
+	resp, err := pm.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return parsePrometheusText(resp.Body, pm.isAllowed)
+}
+
+// Returns true if the metric name matches the allow-list
+func (pm *prometheusManager) isAllowed(name string) bool {
+	for _, pattern := range pm.allowed {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses the prometheus text exposition format.
+// Histogram and summary series (_bucket, _sum, _count) are treated as counters,
+// quantiles as gauges. Untyped metrics are treated as gauges. Invalid sample
+// lines are skipped.
+func parsePrometheusText(r io.Reader, allowed func(string) bool) ([]promSample, error) {
+	types := make(map[string]string)
+	var samples []promSample
+	var skipped int
+	var firstErr error
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// # TYPE metric_name counter
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, value, err := parsePrometheusSample(line)
+		if err != nil {
+			if skipped == 0 {
+				firstErr = err
+			}
+			skipped++
+			continue
+		}
+		if !allowed(name) || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		sample := promSample{name: name, labels: labels, value: value}
+		switch metricType(types, name) {
+		case "counter":
+			sample.counter = true
+		case "histogram", "summary":
+			// quantile series are gauges, everything else accumulates
+			sample.counter = !strings.Contains(labels, "quantile=")
+		}
+		samples = append(samples, sample)
+	}
+	if skipped > 0 {
+		slog.Debug("Skipped invalid prometheus samples", "count", skipped, "err", firstErr)
+	}
+	return samples, scanner.Err()
+}
+
+// Returns the declared type of a metric, resolving histogram / summary suffixes
+func metricType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base, found := strings.CutSuffix(name, suffix); found {
+			if t, ok := types[base]; ok {
+				return t
+			}
+		}
+	}
+	return "untyped"
+}
+
+// Parses a sample line: name{label="value",...} value [timestamp]
+func parsePrometheusSample(line string) (name, labels string, value float64, err error) {
+	rest := line
+	if i := strings.IndexAny(line, "{ \t"); i >= 0 {
+		name, rest = line[:i], line[i:]
+	} else {
+		return "", "", 0, fmt.Errorf("invalid sample: %s", line)
+	}
+
+	if strings.HasPrefix(rest, "{") {
+		end, err := labelsEnd(rest)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("invalid labels: %s", line)
+		}
+		labels, rest = rest[:end+1], rest[end+1:]
+		if labels == "{}" {
+			labels = ""
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", "", 0, fmt.Errorf("missing value: %s", line)
+	}
+	value, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid value: %s", line)
+	}
+	return name, labels, value, nil
+}
+
+// Returns the index of the closing brace of a label set, skipping quoted values
+func labelsEnd(s string) (int, error) {
+	inQuotes := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case '}':
+			if !inQuotes {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated label set")
+}
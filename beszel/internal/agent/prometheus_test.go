@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrometheusSample(t *testing.T) {
+	tests := []struct {
+		line    string
+		name    string
+		labels  string
+		value   float64
+		wantErr bool
+	}{
+		{line: "up 1", name: "up", value: 1},
+		{line: "queue_size 12.5 1700000000000", name: "queue_size", value: 12.5},
+		{line: `http_requests_total{code="200",method="get"} 1027`, name: "http_requests_total", labels: `{code="200",method="get"}`, value: 1027},
+		{line: `msg{text="a } \" b"} 3`, name: "msg", labels: `{text="a } \" b"}`, value: 3},
+		{line: "empty{} 4", name: "empty", value: 4},
+		{line: "temp\t-1.5e2", name: "temp", value: -150},
+		{line: "novalue", wantErr: true},
+		{line: "novalue ", wantErr: true},
+		{line: `open{a="b" 1`, wantErr: true},
+		{line: "bad abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		name, labels, value, err := parsePrometheusSample(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if name != tt.name || labels != tt.labels || value != tt.value {
+			t.Errorf("%q: got %q %q %v, want %q %q %v", tt.line, name, labels, value, tt.name, tt.labels, tt.value)
+		}
+	}
+}
+
+func TestParsePrometheusText(t *testing.T) {
+	text := `# HELP requests_total Requests
+# TYPE requests_total counter
+requests_total{code="200"} 10
+# TYPE latency histogram
+latency_bucket{le="0.1"} 4
+latency_sum 1.5
+latency_count 7
+# TYPE rpc summary
+rpc{quantile="0.5"} 0.2
+rpc_count 9
+queue_size 3
+skipped_metric 1
+queue_nan NaN
+invalid_value abc
+open_labels{a="b" 1
+`
+	samples, err := parsePrometheusText(strings.NewReader(text), func(name string) bool {
+		return name != "skipped_metric"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []promSample{
+		{name: "requests_total", labels: `{code="200"}`, value: 10, counter: true},
+		{name: "latency_bucket", labels: `{le="0.1"}`, value: 4, counter: true},
+		{name: "latency_sum", value: 1.5, counter: true},
+		{name: "latency_count", value: 7, counter: true},
+		{name: "rpc", labels: `{quantile="0.5"}`, value: 0.2},
+		{name: "rpc_count", value: 9, counter: true},
+		{name: "queue_size", value: 3},
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("got %d samples, want %d: %+v", len(samples), len(want), samples)
+	}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: got %+v, want %+v", i, samples[i], want[i])
+		}
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	pm := &prometheusManager{counters: make(map[string]counterPrev)}
+	start := time.Now()
+	steps := []struct {
+		value  float64
+		after  time.Duration
+		rate   float64
+		hasVal bool
+	}{
+		{value: 100, after: 0}, // first sample
+		{value: 160, after: 30 * time.Second, rate: 2, hasVal: true},
+		{value: 10, after: 60 * time.Second}, // counter reset
+		{value: 40, after: 90 * time.Second, rate: 1, hasVal: true},
+		{value: 40, after: 90 * time.Second}, // no time elapsed
+	}
+	for i, step := range steps {
+		rate, ok := pm.counterRate("app", "app.requests_total", step.value, start.Add(step.after))
+		if ok != step.hasVal || rate != step.rate {
+			t.Errorf("step %d: got %v %v, want %v %v", i, rate, ok, step.rate, step.hasVal)
+		}
+	}
+}
+
+func TestPrometheusCollect(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total %d\nqueue_size 3\nother 1\n", requests*100)
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	t.Setenv("PROMETHEUS_METRICS", "requests_*,queue_size")
+	pm, err := newPrometheusManager("app=" + server.URL + ",down=" + failing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// counters need two scrapes
+	metrics := pm.collect()
+	if len(metrics) != 1 || metrics["app.queue_size"] != 3 {
+		t.Errorf("first scrape: got %v", metrics)
+	}
+	metrics = pm.collect()
+	if _, ok := metrics["app.requests_total"]; !ok || len(metrics) != 2 {
+		t.Errorf("second scrape: got %v", metrics)
+	}
+}
+
+func TestPrometheusCollectMissingSeries(t *testing.T) {
+	// the exporter stops reporting the 500 series and an invalid line appears
+	// on the second scrape, then the series comes back
+	scrapes := []string{
+		"requests_total{code=\"200\"} 100\nrequests_total{code=\"500\"} 10\n",
+		"requests_total{code=\"200\"} 200\nrequests_total{code=\"500\" abc\n",
+		"requests_total{code=\"200\"} 300\nrequests_total{code=\"500\"} 20\n",
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE requests_total counter\n"+scrapes[requests])
+		requests++
+	}))
+	defer server.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE requests_total counter\nrequests_total 1\n")
+	}))
+	defer other.Close()
+
+	t.Setenv("PROMETHEUS_METRICS", "requests_total")
+	pm, err := newPrometheusManager("app=" + server.URL + ",other=" + other.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.collect()
+	time.Sleep(10 * time.Millisecond)
+
+	// the invalid line doesn't fail the scrape, and the missing series is
+	// forgotten without affecting the other target
+	metrics := pm.collect()
+	if _, ok := metrics[`app.requests_total{code="200"}`]; !ok {
+		t.Errorf("second scrape: got %v, want the 200 series", metrics)
+	}
+	if _, ok := pm.counters[`app.requests_total{code="500"}`]; ok {
+		t.Error("second scrape: the missing 500 series is still stored")
+	}
+	if _, ok := pm.counters["other.requests_total"]; !ok {
+		t.Error("second scrape: the other target's counter was removed")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// the series that came back needs another scrape for a rate
+	metrics = pm.collect()
+	if _, ok := metrics[`app.requests_total{code="500"}`]; ok {
+		t.Errorf("third scrape: got a rate for the returned series: %v", metrics)
+	}
+	if _, ok := metrics[`app.requests_total{code="200"}`]; !ok {
+		t.Errorf("third scrape: got %v, want the 200 series", metrics)
+	}
+}
+
+func TestNewPrometheusManagerErrors(t *testing.T) {
+	t.Setenv("PROMETHEUS_METRICS", "up")
+	if _, err := newPrometheusManager("app=ftp://127.0.0.1"); err == nil {
+		t.Error("expected an error for a target that isn't http")
+	}
+	if _, err := newPrometheusManager("http://127.0.0.1/metrics"); err == nil {
+		t.Error("expected an error for a target without a name")
+	}
+	t.Setenv("PROMETHEUS_METRICS", "")
+	if _, err := newPrometheusManager("app=http://127.0.0.1/metrics"); err == nil {
+		t.Error("expected an error without PROMETHEUS_METRICS")
+	}
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"beszel"
+	"beszel/internal/entities/system"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests the hub can send as the SSH exec command. A shell session without
+// a command returns stats, which is how hubs that predate the protocol poll.
+var capabilities = []string{"hello", "stats", "backfill"}
+
+// Response encodings the agent supports, most preferred first. The hub picks
+// one with the BESZEL_ENCODING session env var.
+var encodings = []string{system.EncodingCBOR, system.EncodingJSON}
+
+// Returns the response to a request
+func (a *Agent) handleRequest(request string) (any, error) {
+	name, arg, _ := strings.Cut(request, " ")
+	switch name {
+	case "", "stats":
+		a.Lock()
+		defer a.Unlock()
+		a.lastPoll = time.Now()
+		return a.gatherStats(), nil
+	case "hello":
+		return system.Hello{
+			Version:      system.ProtocolVersion,
+			AgentVersion: beszel.Version,
+			Capabilities: capabilities,
+			Encodings:    encodings,
+		}, nil
+	case "backfill":
+		// samples taken after the time in unix milliseconds
+		since, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backfill time: %s", arg)
+		}
+		if a.sampleBuffer == nil {
+			return []system.Sample{}, nil
+		}
+		return a.sampleBuffer.since(time.UnixMilli(since)), nil
+	}
+	return nil, fmt.Errorf("unknown request: %s", request)
+}
+
+// Returns the polling interval the hub sends with stats requests
+func pollInterval(environ []string) (time.Duration, bool) {
+	for _, env := range environ {
+		if value, found := strings.CutPrefix(env, "BESZEL_INTERVAL="); found {
+			seconds, err := strconv.Atoi(value)
+			return time.Duration(seconds) * time.Second, err == nil && seconds > 0
+		}
+	}
+	return 0, false
+}
+
+// Writes the response in the encoding requested in the session environment
+func encodeResponse(w io.Writer, environ []string, response any) error {
+	if slices.Contains(environ, "BESZEL_ENCODING="+system.EncodingCBOR) {
+		return system.CborEncMode.NewEncoder(w).Encode(response)
+	}
+	return json.NewEncoder(w).Encode(response)
+}
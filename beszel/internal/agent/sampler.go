@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/mem"
+	psutilNet "github.com/shirou/gopsutil/v4/net"
+)
+
+// Default interval between samples taken between hub polls
+const defaultSampleInterval = 5 * time.Second
+
+// Lowest and highest value sampled since the last poll
+type sampleRange struct {
+	min, max float64
+	count    int
+}
+
+func (r *sampleRange) add(value float64) {
+	if r.count == 0 || value < r.min {
+		r.min = value
+	}
+	if r.count == 0 || value > r.max {
+		r.max = value
+	}
+	r.count++
+}
+
+// Returns the lowest and highest values including the average for the poll
+// window, which can fall outside the sampled range when there were few samples
+func (r *sampleRange) bounds(avg float64) (float64, float64) {
+	if r.count == 0 {
+		return avg, avg
+	}
+	return min(r.min, avg), max(r.max, avg)
+}
+
+// Samples CPU usage, used memory, and disk and network rates between hub polls
+// so the hub gets the lowest and highest values of each poll window, not only
+// the average. The sampler keeps its own counters, so averages are still
+// calculated from the counters at each poll. Temperatures and GPUs aren't
+// sampled, reading sensors and GPU tools takes too long to repeat every few seconds.
+type rateSampler struct {
+	interval  time.Duration
+	time      time.Time                      // Time of the previous sample, zero to start over
+	cpuTimes  cpu.TimesStat                  // CPU times at the previous sample
+	netSent   uint64                         // Bytes sent at the previous sample
+	netRecv   uint64                         // Bytes received at the previous sample
+	diskIo    map[string]disk.IOCountersStat // Disk counters at the previous sample
+	cpu       sampleRange
+	memUsed   sampleRange
+	netSentPs sampleRange
+	netRecvPs sampleRange
+	diskRead  map[string]*sampleRange // Read rates by device
+	diskWrite map[string]*sampleRange // Write rates by device
+}
+
+// Creates a sampler taking samples every SAMPLE_INTERVAL (default 5s)
+func newRateSampler() (*rateSampler, error) {
+	rs := &rateSampler{interval: defaultSampleInterval}
+	if interval, exists := LookupEnv("SAMPLE_INTERVAL"); exists {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		rs.interval = max(duration, time.Second)
+	}
+	rs.resetRanges()
+	return rs, nil
+}
+
+func (rs *rateSampler) resetRanges() {
+	rs.cpu = sampleRange{}
+	rs.memUsed = sampleRange{}
+	rs.netSentPs = sampleRange{}
+	rs.netRecvPs = sampleRange{}
+	rs.diskRead = make(map[string]*sampleRange)
+	rs.diskWrite = make(map[string]*sampleRange)
+}
+
+// Takes a sample on every interval
+func (a *Agent) sampleRates() {
+	slog.Debug("Sampling between polls", "interval", a.rateSampler.interval)
+	ticker := time.NewTicker(a.rateSampler.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.Lock()
+		a.takeRateSample()
+		a.Unlock()
+	}
+}
+
+// Adds the rates since the previous sample to the sampled ranges
+func (a *Agent) takeRateSample() {
+	rs := a.rateSampler
+	now := time.Now()
+	seconds := now.Sub(rs.time).Seconds()
+	first := rs.time.IsZero()
+	rs.time = now
+
+	// cpu
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		if !first {
+			rs.cpu.add(twoDecimals(cpuBusyPercent(rs.cpuTimes, times[0])))
+		}
+		rs.cpuTimes = times[0]
+	}
+
+	// memory
+	if v, err := mem.VirtualMemory(); err == nil {
+		used, _, _ := a.memoryUsage(v)
+		rs.memUsed.add(bytesToGigabytes(used))
+	}
+
+	// network
+	if netIO, err := psutilNet.IOCounters(true); err == nil {
+		var bytesSent, bytesRecv uint64
+		for _, v := range netIO {
+			if _, exists := a.netInterfaces[v.Name]; exists {
+				bytesSent += v.BytesSent
+				bytesRecv += v.BytesRecv
+			}
+		}
+		// skip if the counters went back, e.g. when an interface was removed
+		if !first && bytesSent >= rs.netSent && bytesRecv >= rs.netRecv {
+			sentPs := bytesToMegabytes(float64(bytesSent-rs.netSent) / seconds)
+			recvPs := bytesToMegabytes(float64(bytesRecv-rs.netRecv) / seconds)
+			// same limit as getSystemStats (#150)
+			if sentPs <= 10_000 && recvPs <= 10_000 {
+				rs.netSentPs.add(sentPs)
+				rs.netRecvPs.add(recvPs)
+			}
+		}
+		rs.netSent, rs.netRecv = bytesSent, bytesRecv
+	}
+
+	// disk i/o
+	if ioCounters, err := disk.IOCounters(a.fsNames...); err == nil {
+		for name, d := range ioCounters {
+			prev, ok := rs.diskIo[name]
+			if first || !ok || d.ReadBytes < prev.ReadBytes || d.WriteBytes < prev.WriteBytes {
+				continue
+			}
+			readPs := bytesToMegabytes(float64(d.ReadBytes-prev.ReadBytes) / seconds)
+			writePs := bytesToMegabytes(float64(d.WriteBytes-prev.WriteBytes) / seconds)
+			if readPs > 50_000 || writePs > 50_000 {
+				continue
+			}
+			if rs.diskRead[name] == nil {
+				rs.diskRead[name] = &sampleRange{}
+				rs.diskWrite[name] = &sampleRange{}
+			}
+			rs.diskRead[name].add(readPs)
+			rs.diskWrite[name].add(writePs)
+		}
+		rs.diskIo = ioCounters
+	}
+}
+
+// Sets the lowest and highest values sampled since the last poll and starts
+// a new poll window. Values are set to the averages if nothing was sampled.
+func (a *Agent) applyRateSamples(stats *system.Stats) {
+	rs := a.rateSampler
+	if rs == nil {
+		// sampling is disabled, so the averages are the only values
+		rs = &rateSampler{}
+	}
+	stats.MinCpu, stats.MaxCpu = rs.cpu.bounds(stats.Cpu)
+	stats.MinMemUsed, stats.MaxMemUsed = rs.memUsed.bounds(stats.MemUsed)
+	stats.MinNetworkSent, stats.MaxNetworkSent = rs.netSentPs.bounds(stats.NetworkSent)
+	stats.MinNetworkRecv, stats.MaxNetworkRecv = rs.netRecvPs.bounds(stats.NetworkRecv)
+	for name, fsStats := range a.fsStats {
+		read, write := rs.diskRead[name], rs.diskWrite[name]
+		if read == nil {
+			read, write = &sampleRange{}, &sampleRange{}
+		}
+		_, fsStats.MaxDiskReadPS = read.bounds(fsStats.DiskReadPs)
+		_, fsStats.MaxDiskWritePS = write.bounds(fsStats.DiskWritePs)
+		if fsStats.Root {
+			stats.MinDiskReadPs, stats.MaxDiskReadPs = read.bounds(stats.DiskReadPs)
+			stats.MinDiskWritePs, stats.MaxDiskWritePs = write.bounds(stats.DiskWritePs)
+		}
+	}
+	rs.resetRanges()
+}
+
+// Returns the percentage of CPU time spent busy between two readings,
+// calculated the same way as cpu.Percent
+func cpuBusyPercent(t1, t2 cpu.TimesStat) float64 {
+	busy := func(t cpu.TimesStat) (float64, float64) {
+		total := t.Total()
+		if runtime.GOOS == "linux" {
+			// guest time is already included in user time
+			total -= t.Guest + t.GuestNice
+		}
+		return total, total - t.Idle - t.Iowait
+	}
+	t1All, t1Busy := busy(t1)
+	t2All, t2Busy := busy(t2)
+	if t2Busy <= t1Busy {
+		return 0
+	}
+	if t2All <= t1All {
+		return 100
+	}
+	return min(100, (t2Busy-t1Busy)/(t2All-t1All)*100)
+}
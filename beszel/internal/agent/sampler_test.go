@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+)
+
+func TestCpuBusyPercent(t *testing.T) {
+	t1 := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 50}
+	tests := []struct {
+		name string
+		t2   cpu.TimesStat
+		want float64
+	}{
+		{name: "busy", t2: cpu.TimesStat{User: 130, System: 70, Idle: 840, Iowait: 60}, want: 50},
+		{name: "idle", t2: cpu.TimesStat{User: 100, System: 50, Idle: 900, Iowait: 50}, want: 0},
+		{name: "fully busy", t2: cpu.TimesStat{User: 150, System: 100, Idle: 800, Iowait: 50}, want: 100},
+		{name: "iowait is idle", t2: cpu.TimesStat{User: 110, System: 50, Idle: 800, Iowait: 140}, want: 10},
+		{name: "counters reset", t2: cpu.TimesStat{User: 10, System: 5, Idle: 80}, want: 0},
+		{name: "busy without total increase", t2: cpu.TimesStat{User: 150, System: 50, Idle: 750, Iowait: 50}, want: 100},
+	}
+	for _, tt := range tests {
+		if got := cpuBusyPercent(t1, tt.t2); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCpuBusyPercentGuest(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("guest time is only part of user time on linux")
+	}
+	t1 := cpu.TimesStat{User: 100, Idle: 100, Guest: 50}
+	// 100 of user time, 50 of it guest, and 100 idle
+	t2 := cpu.TimesStat{User: 200, Idle: 200, Guest: 100}
+	if got := cpuBusyPercent(t1, t2); got != 50 {
+		t.Errorf("got %v, want 50", got)
+	}
+}
+
+func TestSampleRangeBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		avg     float64
+		wantMin float64
+		wantMax float64
+	}{
+		{name: "no samples", avg: 5, wantMin: 5, wantMax: 5},
+		{name: "average inside range", samples: []float64{2, 9, 4}, avg: 5, wantMin: 2, wantMax: 9},
+		{name: "average below range", samples: []float64{6, 8}, avg: 5, wantMin: 5, wantMax: 8},
+		{name: "average above range", samples: []float64{1, 3}, avg: 5, wantMin: 1, wantMax: 5},
+		{name: "zero sample", samples: []float64{0, 3}, avg: 2, wantMin: 0, wantMax: 3},
+	}
+	for _, tt := range tests {
+		var r sampleRange
+		for _, value := range tt.samples {
+			r.add(value)
+		}
+		if low, high := r.bounds(tt.avg); low != tt.wantMin || high != tt.wantMax {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, low, high, tt.wantMin, tt.wantMax)
+		}
+	}
+}
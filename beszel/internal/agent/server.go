@@ -1,32 +1,58 @@
 package agent
 
 import (
-	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 
 	sshServer "github.com/gliderlabs/ssh"
 )
 
-func (a *Agent) startServer(pubKey []byte, addr string) {
-	sshServer.Handle(a.handleSession)
+// Creates the SSH server used for both incoming and hub-bound connections
+func (a *Agent) newServer(keys *authorizedKeys, addr string) *sshServer.Server {
+	server := &sshServer.Server{
+		Addr:    addr,
+		Handler: a.handleSession,
+		// set explicitly because HandleConn doesn't apply the defaults like Serve does
+		ChannelHandlers: sshServer.DefaultChannelHandlers,
+	}
+	signer, err := loadHostKey()
+	if err != nil {
+		slog.Error("Error loading host key", "err", err)
+		os.Exit(1)
+	}
+	server.AddHostKey(signer)
+	server.SetOption(sshServer.NoPty())
+	server.SetOption(sshServer.PublicKeyAuth(func(ctx sshServer.Context, key sshServer.PublicKey) bool {
+		return keys.isAuthorized(key)
+	}))
+	return server
+}
 
-	slog.Info("Starting SSH server", "address", addr)
-	if err := sshServer.ListenAndServe(addr, nil, sshServer.NoPty(),
-		sshServer.PublicKeyAuth(func(ctx sshServer.Context, key sshServer.PublicKey) bool {
-			allowed, _, _, _, _ := sshServer.ParseAuthorizedKey(pubKey)
-			return sshServer.KeysEqual(key, allowed)
-		}),
-	); err != nil {
+func (a *Agent) startServer(server *sshServer.Server) {
+	slog.Info("Starting SSH server", "address", server.Addr)
+	if err := server.ListenAndServe(); err != nil {
 		slog.Error("Error starting SSH server", "err", err)
 		os.Exit(1)
 	}
 }
 
 func (a *Agent) handleSession(s sshServer.Session) {
-	stats := a.gatherStats()
-	if err := json.NewEncoder(s).Encode(stats); err != nil {
-		slog.Error("Error encoding stats", "err", err, "stats", stats)
+	a.Lock()
+	a.applyRemoteConfig(s.Environ())
+	// remember how often the hub polls (older hubs don't send it)
+	if interval, ok := pollInterval(s.Environ()); ok {
+		a.pollInterval = interval
+	}
+	a.Unlock()
+	response, err := a.handleRequest(s.RawCommand())
+	if err != nil {
+		fmt.Fprintln(s.Stderr(), err)
+		s.Exit(2)
+		return
+	}
+	if err := encodeResponse(s, s.Environ(), response); err != nil {
+		slog.Error("Error encoding response", "err", err, "request", s.RawCommand())
 		s.Exit(1)
 		return
 	}
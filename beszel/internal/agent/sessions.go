@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// Auth logs checked for failed SSH logins if AUTH_LOG is not set
+var authLogPaths = []string{"/var/log/auth.log", "/var/log/secure"}
+
+// Matches failed SSH authentication attempts, including attempts for invalid users
+var failedLoginRegex = regexp.MustCompile(`sshd(-session)?\[\d+\]: Failed \S+ for `)
+
+type sessionTracker struct {
+	sync.Mutex
+	authLog       *watchedFile // Auth log followed for failed logins, nil if the journal is used
+	failedLogins  *logPattern  // Counts failed logins in the auth log
+	journal       bool         // True if failed logins are read from the journal
+	journalCursor string       // Cursor of the last journal entry read
+	journalSince  time.Time    // Start time used until a cursor is known
+}
+
+// Creates a session tracker. Failed SSH logins are read from the AUTH_LOG file,
+// /var/log/auth.log or /var/log/secure, or the systemd journal if no log file exists.
+func newSessionTracker() *sessionTracker {
+	st := &sessionTracker{
+		failedLogins: &logPattern{name: "ssh", re: failedLoginRegex},
+		journalSince: time.Now(),
+	}
+
+	paths := authLogPaths
+	if path, exists := LookupEnv("AUTH_LOG"); exists {
+		paths = []string{path}
+	}
+	for _, path := range paths {
+		wf := &watchedFile{path: path, patterns: []*logPattern{st.failedLogins}}
+		// start at the end so old failures aren't counted
+		if err := wf.open(true); err == nil {
+			slog.Info("Reading failed logins", "path", path)
+			st.authLog = wf
+			return st
+		}
+	}
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		slog.Info("Reading failed logins from journal")
+		st.journal = true
+	} else {
+		slog.Debug("No auth log found, not counting failed logins")
+	}
+	return st
+}
+
+// Returns current interactive sessions from utmp
+func (st *sessionTracker) getSessions() []system.Session {
+	users, err := host.Users()
+	if err != nil {
+		slog.Debug("Error reading sessions", "err", err)
+		return nil
+	}
+	sessions := make([]system.Session, 0, len(users))
+	for _, user := range users {
+		sessions = append(sessions, system.Session{
+			User:    user.User,
+			Tty:     user.Terminal,
+			Host:    user.Host,
+			Started: time.Unix(int64(user.Started), 0).UTC(),
+		})
+	}
+	return sessions
+}
+
+// Returns the number of failed SSH logins since the last call
+func (st *sessionTracker) getFailedLogins() int {
+	st.Lock()
+	defer st.Unlock()
+
+	switch {
+	case st.authLog != nil:
+		if err := st.authLog.poll(); err != nil {
+			slog.Debug("Error reading auth log", "path", st.authLog.path, "err", err)
+		}
+		count := st.failedLogins.count
+		st.failedLogins.count = 0
+		return count
+	case st.journal:
+		count, err := st.readJournal()
+		if err != nil {
+			slog.Debug("Error reading journal", "err", err)
+		}
+		return count
+	}
+	return 0
+}
+
+// Counts failed logins in sshd journal entries since the last call
+func (st *sessionTracker) readJournal() (int, error) {
+	args := []string{"--no-pager", "--output=cat", "--show-cursor", "--identifier=sshd", "--identifier=sshd-session"}
+	if st.journalCursor != "" {
+		args = append(args, "--after-cursor="+st.journalCursor)
+	} else {
+		args = append(args, "--since=@"+strconv.FormatInt(st.journalSince.Unix(), 10))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cursor, found := strings.CutPrefix(line, "-- cursor: "); found {
+			st.journalCursor = cursor
+			continue
+		}
+		// --output=cat omits the identifier, so match the message only
+		if strings.HasPrefix(line, "Failed ") && strings.Contains(line, " for ") {
+			count++
+		}
+	}
+	return count, nil
+}
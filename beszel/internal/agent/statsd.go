@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of timer values kept per metric between polls
+const maxTimerSamples = 10_000
+
+type statsdServer struct {
+	sync.Mutex
+	conn     net.PacketConn
+	counters map[string]float64   // Counter totals since the last poll
+	gauges   map[string]float64   // Last gauge values (kept between polls)
+	timers   map[string][]float64 // Timer values since the last poll
+	sets     map[string]map[string]struct{}
+	since    time.Time // Start of the current aggregation window
+}
+
+// Starts a StatsD listener on the STATSD_ADDR address, e.g. 127.0.0.1:8125.
+// Metrics are aggregated between polls and returned as custom metrics prefixed
+// with "statsd.". Counters are per second rates, timers include percentiles.
+func newStatsdServer(addr string) (*statsdServer, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &statsdServer{conn: conn}
+	s.reset()
+	s.gauges = make(map[string]float64)
+	slog.Info("Starting StatsD listener", "address", conn.LocalAddr())
+	go s.listen()
+	return s, nil
+}
+
+// Reads packets until the connection is closed
+func (s *statsdServer) listen() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("StatsD read error", "err", err)
+			continue
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if err := s.handleLine(line); err != nil {
+				slog.Debug("StatsD", "err", err)
+			}
+		}
+	}
+}
+
+// Parses and aggregates a metric line: name:value|type[|@sample_rate][|#tags]
+func (s *statsdServer) handleLine(line string) error {
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return fmt.Errorf("invalid line: %s", line)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return fmt.Errorf("missing type: %s", line)
+	}
+	rawValue, metricType := parts[0], parts[1]
+
+	sampleRate := 1.0
+	for _, part := range parts[2:] {
+		if strings.HasPrefix(part, "@") {
+			if rate, err := strconv.ParseFloat(part[1:], 64); err == nil && rate > 0 && rate <= 1 {
+				sampleRate = rate
+			}
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if metricType == "s" {
+		if s.sets[name] == nil {
+			s.sets[name] = make(map[string]struct{})
+		}
+		s.sets[name][rawValue] = struct{}{}
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value: %s", line)
+	}
+
+	switch metricType {
+	case "c":
+		s.counters[name] += value / sampleRate
+	case "g":
+		// signed values modify the current gauge
+		if strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-") {
+			s.gauges[name] += value
+		} else {
+			s.gauges[name] = value
+		}
+	case "ms", "h", "d":
+		if len(s.timers[name]) < maxTimerSamples {
+			s.timers[name] = append(s.timers[name], value)
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", line)
+	}
+	return nil
+}
+
+// Returns aggregated metrics since the last call and resets the aggregates
+func (s *statsdServer) collect() map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	elapsed := time.Since(s.since).Seconds()
+	metrics := make(map[string]float64, len(s.counters)+len(s.gauges)+len(s.timers)*6+len(s.sets))
+	for name, value := range s.counters {
+		metrics["statsd."+name] = twoDecimals(value / elapsed)
+	}
+	for name, value := range s.gauges {
+		metrics["statsd."+name] = twoDecimals(value)
+	}
+	for name, values := range s.sets {
+		metrics["statsd."+name] = float64(len(values))
+	}
+	for name, values := range s.timers {
+		slices.Sort(values)
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		prefix := "statsd." + name
+		metrics[prefix+".count"] = float64(len(values))
+		metrics[prefix+".mean"] = twoDecimals(sum / float64(len(values)))
+		metrics[prefix+".max"] = twoDecimals(values[len(values)-1])
+		metrics[prefix+".p50"] = twoDecimals(percentile(values, 50))
+		metrics[prefix+".p90"] = twoDecimals(percentile(values, 90))
+		metrics[prefix+".p99"] = twoDecimals(percentile(values, 99))
+	}
+
+	s.reset()
+	return metrics
+}
+
+// Clears counters, timers and sets and starts a new aggregation window
+func (s *statsdServer) reset() {
+	s.counters = make(map[string]float64)
+	s.timers = make(map[string][]float64)
+	s.sets = make(map[string]map[string]struct{})
+	s.since = time.Now()
+}
+
+// Returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
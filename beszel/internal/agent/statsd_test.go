@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Starts a listener on a loopback port and returns it with a connection to it
+func newTestStatsdServer(t *testing.T) (*statsdServer, net.Conn) {
+	t.Helper()
+	s, err := newStatsdServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.conn.Close() })
+	conn, err := net.Dial("udp", s.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+// Sends the lines in one packet and waits until the listener handled them,
+// using a gauge set by the last line
+func sendStatsd(t *testing.T, s *statsdServer, conn net.Conn, lines ...string) {
+	t.Helper()
+	marker := "sent" + time.Now().Format("150405.000000000")
+	if _, err := conn.Write([]byte(strings.Join(append(lines, marker+":1|g"), "\n"))); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		s.Lock()
+		_, received := s.gauges[marker]
+		delete(s.gauges, marker)
+		s.Unlock()
+		if received {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the packet")
+		}
+	}
+}
+
+// Collects metrics as if the window started the number of seconds ago
+func collectAfter(s *statsdServer, seconds int) map[string]float64 {
+	s.Lock()
+	s.since = time.Now().Add(-time.Duration(seconds) * time.Second)
+	s.Unlock()
+	return s.collect()
+}
+
+func TestStatsdCounterRate(t *testing.T) {
+	s, conn := newTestStatsdServer(t)
+	sendStatsd(t, s, conn, "requests:30|c", "requests:50|c", "sampled:10|c|@0.5", "errors:1|c|#env:prod")
+	want := map[string]float64{"statsd.requests": 8, "statsd.sampled": 2, "statsd.errors": 0.1}
+	if got := collectAfter(s, 10); !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// counters are reset after each poll
+	if got := collectAfter(s, 10); len(got) != 0 {
+		t.Errorf("got %v after reset, want none", got)
+	}
+}
+
+func TestStatsdGauges(t *testing.T) {
+	s, conn := newTestStatsdServer(t)
+	sendStatsd(t, s, conn, "queue:10|g", "queue:+5|g", "queue:-3|g", "temp:-2|g", "workers:4|g")
+	want := map[string]float64{"statsd.queue": 12, "statsd.temp": -2, "statsd.workers": 4}
+	if got := collectAfter(s, 10); !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// gauges are kept between polls and signed values apply to the kept value
+	sendStatsd(t, s, conn, "queue:-2|g", "temp:0|g")
+	want = map[string]float64{"statsd.queue": 10, "statsd.temp": 0, "statsd.workers": 4}
+	if got := collectAfter(s, 10); !maps.Equal(got, want) {
+		t.Errorf("got %v after the next poll, want %v", got, want)
+	}
+}
+
+func TestStatsdTimers(t *testing.T) {
+	s, conn := newTestStatsdServer(t)
+	lines := []string{"users:alice|s", "users:bob|s", "users:alice|s"}
+	// 1 to 100 ms out of order
+	for i := range 100 {
+		lines = append(lines, "db.query:"+strconv.Itoa(i*37%100+1)+"|ms")
+	}
+	sendStatsd(t, s, conn, lines...)
+	got := collectAfter(s, 10)
+	want := map[string]float64{
+		"statsd.users":          2,
+		"statsd.db.query.count": 100,
+		"statsd.db.query.mean":  50.5,
+		"statsd.db.query.max":   100,
+		"statsd.db.query.p50":   50,
+		"statsd.db.query.p90":   90,
+		"statsd.db.query.p99":   99,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// timers and sets are reset after each poll
+	if got := collectAfter(s, 10); len(got) != 0 {
+		t.Errorf("got %v after reset, want none", got)
+	}
+}
+
+func TestStatsdInvalidLines(t *testing.T) {
+	s := &statsdServer{gauges: make(map[string]float64)}
+	s.reset()
+	for _, line := range []string{"novalue", ":1|c", "name:1", "name:abc|c", "name:1|x"} {
+		if err := s.handleLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+	if got := s.collect(); len(got) != 0 {
+		t.Errorf("invalid lines were aggregated: %v", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4}
+	tests := []struct {
+		p    float64
+		want float64
+	}{{0, 1}, {25, 1}, {50, 2}, {75, 3}, {90, 4}, {100, 4}}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("p%v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("empty = %v, want 0", got)
+	}
+}
@@ -48,6 +48,28 @@ func (a *Agent) initializeSystemInfo() {
 	}
 }
 
+// Returns used memory, cache and buffers, and the ZFS ARC size using the
+// MEM_CALC formula. The ZFS ARC is subtracted from used memory.
+func (a *Agent) memoryUsage(v *mem.VirtualMemoryStat) (used, cacheBuff, arcSize uint64) {
+	used = v.Used
+	// cache + buffers value for default mem calculation
+	cacheBuff = v.Total - v.Free - v.Used
+	// htop memory calculation overrides
+	if a.memCalc == "htop" {
+		// note: gopsutil automatically adds SReclaimable to v.Cached
+		cacheBuff = v.Cached + v.Buffers - v.Shared
+		used = v.Total - (v.Free + cacheBuff)
+	}
+	// subtract ZFS ARC size from used memory and add as its own category
+	if a.zfs {
+		if arc, _ := getARCSize(); arc > 0 && arc < used {
+			used -= arc
+			arcSize = arc
+		}
+	}
+	return used, cacheBuff, arcSize
+}
+
 // Returns current info, stats about the host system
 func (a *Agent) getSystemStats() system.Stats {
 	systemStats := system.Stats{}
@@ -65,27 +87,18 @@ func (a *Agent) getSystemStats() system.Stats {
 		// swap
 		systemStats.Swap = bytesToGigabytes(v.SwapTotal)
 		systemStats.SwapUsed = bytesToGigabytes(v.SwapTotal - v.SwapFree - v.SwapCached)
-		// cache + buffers value for default mem calculation
-		cacheBuff := v.Total - v.Free - v.Used
-		// htop memory calculation overrides
-		if a.memCalc == "htop" {
-			// note: gopsutil automatically adds SReclaimable to v.Cached
-			cacheBuff = v.Cached + v.Buffers - v.Shared
-			v.Used = v.Total - (v.Free + cacheBuff)
-			v.UsedPercent = float64(v.Used) / float64(v.Total) * 100.0
-		}
-		// subtract ZFS ARC size from used memory and add as its own category
-		if a.zfs {
-			if arcSize, _ := getARCSize(); arcSize > 0 && arcSize < v.Used {
-				v.Used = v.Used - arcSize
-				v.UsedPercent = float64(v.Used) / float64(v.Total) * 100.0
-				systemStats.MemZfsArc = bytesToGigabytes(arcSize)
-			}
+		used, cacheBuff, arcSize := a.memoryUsage(v)
+		usedPercent := v.UsedPercent
+		if used != v.Used {
+			usedPercent = float64(used) / float64(v.Total) * 100.0
 		}
 		systemStats.Mem = bytesToGigabytes(v.Total)
 		systemStats.MemBuffCache = bytesToGigabytes(cacheBuff)
-		systemStats.MemUsed = bytesToGigabytes(v.Used)
-		systemStats.MemPct = twoDecimals(v.UsedPercent)
+		systemStats.MemUsed = bytesToGigabytes(used)
+		systemStats.MemPct = twoDecimals(usedPercent)
+		if arcSize > 0 {
+			systemStats.MemZfsArc = bytesToGigabytes(arcSize)
+		}
 	}
 
 	// disk usage
@@ -177,6 +190,9 @@ func (a *Agent) getSystemStats() system.Stats {
 		}
 	}
 
+	// lowest and highest values sampled since the last poll
+	a.applyRateSamples(&systemStats)
+
 	// temperatures (skip if sensors whitelist is set to empty string)
 	if a.sensorsWhitelist != nil && len(a.sensorsWhitelist) == 0 {
 		slog.Debug("Skipping temperature collection")
@@ -234,6 +250,7 @@ func (a *Agent) getSystemStats() system.Stats {
 	a.systemInfo.DiskPct = systemStats.DiskPct
 	a.systemInfo.Uptime, _ = host.Uptime()
 	a.systemInfo.Bandwidth = twoDecimals(systemStats.NetworkSent + systemStats.NetworkRecv)
+	a.refreshInventory()
 	slog.Debug("sysinfo", "data", a.systemInfo)
 
 	return systemStats
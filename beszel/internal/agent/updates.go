@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default interval between package update checks
+const defaultUpdateCheckInterval = 6 * time.Hour
+
+// Files whose existence means a reboot is required
+var rebootRequiredFiles = []string{"/var/run/reboot-required", "/run/reboot-required"}
+
+type updateChecker struct {
+	sync.Mutex
+	manager  string        // Package manager used for checks
+	interval time.Duration // Time between checks
+	status   updateStatus  // Result of the last check
+	checked  bool          // True once a check has completed
+}
+
+type updateStatus struct {
+	updates         int  // Number of pending package updates
+	securityUpdates int  // Number of pending updates that fix security issues
+	rebootRequired  bool // True if the system needs a reboot to apply updates
+}
+
+// Creates an update checker for the first supported package manager found.
+// Checks run in the background every UPDATES_INTERVAL (default 6h) because
+// they can be slow. Returns nil if no supported package manager is found.
+func newUpdateChecker() (*updateChecker, error) {
+	uc := &updateChecker{interval: defaultUpdateCheckInterval}
+	if interval, exists := LookupEnv("UPDATES_INTERVAL"); exists {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		uc.interval = max(duration, time.Minute)
+	}
+	for _, manager := range []string{"apt-get", "dnf", "yum", "apk", "pacman"} {
+		if _, err := exec.LookPath(manager); err == nil {
+			uc.manager = manager
+			break
+		}
+	}
+	if uc.manager == "" {
+		slog.Debug("No supported package manager found")
+		return nil, nil
+	}
+	slog.Info("Checking package updates", "manager", uc.manager, "interval", uc.interval)
+	go uc.run()
+	return uc, nil
+}
+
+// Checks for updates now and then on every interval
+func (uc *updateChecker) run() {
+	for {
+		status, err := uc.check()
+		if err != nil {
+			slog.Error("Error checking package updates", "manager", uc.manager, "err", err)
+		} else {
+			slog.Debug("Package updates", "updates", status.updates, "security", status.securityUpdates, "reboot", status.rebootRequired)
+			uc.Lock()
+			uc.status = status
+			uc.checked = true
+			uc.Unlock()
+		}
+		time.Sleep(uc.interval)
+	}
+}
+
+// Returns the result of the last check and false if no check has completed yet
+func (uc *updateChecker) getStatus() (updateStatus, bool) {
+	uc.Lock()
+	defer uc.Unlock()
+	return uc.status, uc.checked
+}
+
+// Counts pending updates using the package manager and checks if a reboot is required
+func (uc *updateChecker) check() (updateStatus, error) {
+	var status updateStatus
+	var err error
+	switch uc.manager {
+	case "apt-get":
+		status, err = checkApt()
+	case "dnf", "yum":
+		status, err = checkDnf(uc.manager)
+	case "apk":
+		status, err = checkApk()
+	case "pacman":
+		status, err = checkPacman()
+	}
+	if err != nil {
+		return status, err
+	}
+	status.rebootRequired = status.rebootRequired || rebootRequired()
+	return status, nil
+}
+
+// Runs a command with a timeout and returns its output. Exit codes listed in
+// okCodes are not treated as errors (e.g. dnf check-update exits 100 if updates exist).
+func runUpdateCommand(name string, args []string, okCodes ...int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LANG=C", "LC_ALL=C")
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		for _, code := range okCodes {
+			if exitErr.ExitCode() == code {
+				return output, nil
+			}
+		}
+	}
+	return output, err
+}
+
+// Simulates an upgrade using the cached package lists. Lines look like:
+// Inst openssl [3.0.11-1~deb12u1] (3.0.13-1~deb12u1 Debian-Security:12/stable-security [amd64])
+func checkApt() (updateStatus, error) {
+	output, err := runUpdateCommand("apt-get", []string{"-s", "-o", "Debug::NoLocking=true", "dist-upgrade"})
+	if err != nil {
+		return updateStatus{}, err
+	}
+	return parseAptOutput(output), nil
+}
+
+func parseAptOutput(output []byte) updateStatus {
+	var status updateStatus
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		status.updates++
+		if strings.Contains(strings.ToLower(line), "-security") {
+			status.securityUpdates++
+		}
+	}
+	return status
+}
+
+// Lists available updates and security advisories. needs-restarting (dnf-utils)
+// is used to detect a required reboot if it's installed.
+func checkDnf(manager string) (updateStatus, error) {
+	var status updateStatus
+	output, err := runUpdateCommand(manager, []string{"-q", "check-update"}, 100)
+	if err != nil {
+		return status, err
+	}
+	status.updates = countDnfPackages(output)
+
+	output, err = runUpdateCommand(manager, []string{"-q", "updateinfo", "list", "--security", "--available"})
+	if err != nil {
+		slog.Debug("Error listing security updates", "err", err)
+	} else {
+		status.securityUpdates = countDnfSecurityPackages(output)
+	}
+
+	if _, err := exec.LookPath("needs-restarting"); err == nil {
+		// exits 1 if a reboot is required
+		if _, err := runUpdateCommand("needs-restarting", []string{"-r"}); err != nil {
+			var exitErr *exec.ExitError
+			status.rebootRequired = errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+		}
+	}
+	return status, nil
+}
+
+// Counts package lines in check-update output, stopping at the obsoletes section
+func countDnfPackages(output []byte) int {
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		// package lines are "name.arch version repo"; wrapped lines start with a space
+		if len(strings.Fields(line)) == 3 && !strings.HasPrefix(line, " ") {
+			count++
+		}
+	}
+	return count
+}
+
+// Counts unique packages in updateinfo output: "ADVISORY TYPE/SEVERITY PACKAGE"
+func countDnfSecurityPackages(output []byte) int {
+	packages := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 {
+			packages[fields[len(fields)-1]] = struct{}{}
+		}
+	}
+	return len(packages)
+}
+
+// Lists installed packages older than the cached index. apk doesn't
+// provide security information.
+func checkApk() (updateStatus, error) {
+	output, err := runUpdateCommand("apk", []string{"version", "-l", "<"})
+	if err != nil {
+		return updateStatus{}, err
+	}
+	var status updateStatus
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "<") {
+			status.updates++
+		}
+	}
+	return status, nil
+}
+
+// Uses checkupdates (pacman-contrib) if installed, which syncs a copy of the
+// database, otherwise lists updates from the local sync database.
+// pacman doesn't provide security information.
+func checkPacman() (updateStatus, error) {
+	var output []byte
+	var err error
+	if _, lookErr := exec.LookPath("checkupdates"); lookErr == nil {
+		// exits 2 if there are no updates
+		output, err = runUpdateCommand("checkupdates", nil, 2)
+	} else {
+		// exits 1 if there are no updates
+		output, err = runUpdateCommand("pacman", []string{"-Qu"}, 1)
+	}
+	if err != nil {
+		return updateStatus{}, err
+	}
+	var status updateStatus
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), " -> ") {
+			status.updates++
+		}
+	}
+	return status, nil
+}
+
+// Returns true if a reboot-required flag file exists (Debian / Ubuntu)
+func rebootRequired() bool {
+	for _, path := range rebootRequiredFiles {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUpdateCheckerStatus(t *testing.T) {
+	uc := &updateChecker{}
+	if _, checked := uc.getStatus(); checked {
+		t.Error("status is checked before the first check")
+	}
+	uc.status, uc.checked = updateStatus{updates: 0, securityUpdates: 0}, true
+	status, checked := uc.getStatus()
+	if !checked {
+		t.Fatal("status isn't checked after the first check")
+	}
+
+	// zero counts are sent once checked, but not before
+	info, err := json.Marshal(system.Info{Updates: &status.updates, SecurityUpdates: &status.securityUpdates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(info), `"up":0`) || !strings.Contains(string(info), `"su":0`) {
+		t.Errorf("checked counts missing from %s", info)
+	}
+	info, err = json.Marshal(system.Info{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(info), `"up"`) || strings.Contains(string(info), `"su"`) {
+		t.Errorf("unchecked counts sent in %s", info)
+	}
+}
@@ -1,6 +1,9 @@
 package agent
 
-import "math"
+import (
+	"beszel/internal/entities/system"
+	"math"
+)
 
 func bytesToMegabytes(b float64) float64 {
 	return twoDecimals(b / 1048576)
@@ -13,3 +16,16 @@ func bytesToGigabytes(b uint64) float64 {
 func twoDecimals(value float64) float64 {
 	return math.Round(value*100) / 100
 }
+
+// Adds metrics to the custom metrics map of the stats
+func addCustomMetrics(stats *system.Stats, metrics map[string]float64) {
+	if len(metrics) == 0 {
+		return
+	}
+	if stats.Custom == nil {
+		stats.Custom = make(map[string]float64, len(metrics))
+	}
+	for key, value := range metrics {
+		stats.Custom[key] = value
+	}
+}
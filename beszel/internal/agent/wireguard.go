@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type wireguardManager struct {
+	sync.Mutex
+	previous map[string]wgTransfer // Transfer counters from the previous poll, keyed by interface and peer key
+}
+
+type wgTransfer struct {
+	time time.Time
+	rx   uint64
+	tx   uint64
+}
+
+// Creates a WireGuard manager if the wg tool is installed
+func newWireguardManager() *wireguardManager {
+	if _, err := exec.LookPath("wg"); err != nil {
+		return nil
+	}
+	slog.Info("Monitoring WireGuard interfaces")
+	return &wireguardManager{previous: make(map[string]wgTransfer)}
+}
+
+// Returns all WireGuard interfaces and peers from `wg show all dump`
+func (wm *wireguardManager) getInterfaces() ([]system.WireGuardInterface, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "wg", "show", "all", "dump").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	wm.Lock()
+	defer wm.Unlock()
+	interfaces, current := parseWgDump(output, time.Now(), wm.previous)
+	wm.previous = current
+	return interfaces, nil
+}
+
+// Parses `wg show all dump` output. Lines are tab separated:
+//
+//	interface: name private-key public-key listen-port fwmark
+//	peer: name public-key preshared-key endpoint allowed-ips latest-handshake rx tx keepalive
+//
+// Transfer rates are calculated from the previous counters.
+func parseWgDump(output []byte, now time.Time, previous map[string]wgTransfer) ([]system.WireGuardInterface, map[string]wgTransfer) {
+	var interfaces []system.WireGuardInterface
+	current := make(map[string]wgTransfer)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch len(fields) {
+		case 5:
+			port, _ := strconv.Atoi(fields[3])
+			interfaces = append(interfaces, system.WireGuardInterface{
+				Name:       fields[0],
+				PublicKey:  fields[2],
+				ListenPort: port,
+			})
+		case 9:
+			if len(interfaces) == 0 || interfaces[len(interfaces)-1].Name != fields[0] {
+				continue
+			}
+			peer := system.WireGuardPeer{
+				PublicKey:    fields[1],
+				HandshakeAge: -1,
+			}
+			if fields[3] != "(none)" {
+				peer.Endpoint = fields[3]
+			}
+			if fields[4] != "(none)" {
+				peer.AllowedIps = fields[4]
+			}
+			if handshake, _ := strconv.ParseInt(fields[5], 10, 64); handshake > 0 {
+				peer.HandshakeAge = max(0, now.Unix()-handshake)
+			}
+			rx, _ := strconv.ParseUint(fields[6], 10, 64)
+			tx, _ := strconv.ParseUint(fields[7], 10, 64)
+			peer.Rx, peer.Tx = rx, tx
+
+			key := fields[0] + " " + fields[1]
+			if prev, ok := previous[key]; ok {
+				if elapsed := now.Sub(prev.time).Seconds(); elapsed > 0 {
+					peer.RxRate = bytesToMegabytes(float64(delta(rx, prev.rx)) / elapsed)
+					peer.TxRate = bytesToMegabytes(float64(delta(tx, prev.tx)) / elapsed)
+				}
+			}
+			current[key] = wgTransfer{time: now, rx: rx, tx: tx}
+
+			iface := &interfaces[len(interfaces)-1]
+			iface.Peers = append(iface.Peers, peer)
+		}
+	}
+	return interfaces, current
+}
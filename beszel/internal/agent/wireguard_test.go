@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"beszel/internal/entities/system"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWgDump(t *testing.T) {
+	now := time.Unix(1700000600, 0)
+	dump := strings.Join([]string{
+		"wg0\tcHJpdmF0ZQ==\twg0-public\t51820\toff",
+		"wg0\tpeer-a\t(none)\t203.0.113.5:51820\t10.0.0.2/32,fd00::2/128\t1700000500\t1048576\t2097152\t25",
+		"wg0\tpeer-b\t(none)\t(none)\t10.0.0.3/32\t0\t0\t0\toff",
+		"wg1\tcHJpdmF0ZQ==\twg1-public\t0\toff",
+		"wg1\tpeer-c\tcHNr\t198.51.100.7:41000\t(none)\t1700000700\t10\t20\toff",
+		// peer lines of an interface not listed before them are ignored
+		"wg2\tpeer-d\t(none)\t(none)\t(none)\t0\t0\t0\toff",
+		"malformed line",
+	}, "\n")
+
+	interfaces, current := parseWgDump([]byte(dump), now, map[string]wgTransfer{})
+	want := []system.WireGuardInterface{
+		{Name: "wg0", PublicKey: "wg0-public", ListenPort: 51820, Peers: []system.WireGuardPeer{
+			{PublicKey: "peer-a", Endpoint: "203.0.113.5:51820", AllowedIps: "10.0.0.2/32,fd00::2/128", HandshakeAge: 100, Rx: 1048576, Tx: 2097152},
+			// a handshake time of 0 means the peer never completed one
+			{PublicKey: "peer-b", AllowedIps: "10.0.0.3/32", HandshakeAge: -1},
+		}},
+		// a handshake ahead of the agent's clock is reported as just now
+		{Name: "wg1", PublicKey: "wg1-public", Peers: []system.WireGuardPeer{
+			{PublicKey: "peer-c", Endpoint: "198.51.100.7:41000", HandshakeAge: 0, Rx: 10, Tx: 20},
+		}},
+	}
+	if !reflect.DeepEqual(interfaces, want) {
+		t.Fatalf("first poll:\n got %+v\nwant %+v", interfaces, want)
+	}
+	if len(current) != 3 {
+		t.Errorf("got counters for %d peers, want 3", len(current))
+	}
+
+	// rates are calculated from the previous poll, and a reset counter
+	// doesn't report a negative rate
+	dump = strings.Join([]string{
+		"wg0\tcHJpdmF0ZQ==\twg0-public\t51820\toff",
+		"wg0\tpeer-a\t(none)\t203.0.113.5:51820\t10.0.0.2/32\t1700000500\t3145728\t2097152\t25",
+		"wg1\tcHJpdmF0ZQ==\twg1-public\t0\toff",
+		"wg1\tpeer-c\tcHNr\t198.51.100.7:41000\t(none)\t1700000700\t5\t20\toff",
+	}, "\n")
+	interfaces, current = parseWgDump([]byte(dump), now.Add(2*time.Second), current)
+	if peer := interfaces[0].Peers[0]; peer.RxRate != 1 || peer.TxRate != 0 || peer.HandshakeAge != 102 {
+		t.Errorf("peer-a: got rx %v tx %v MB/s handshake %ds, want 1, 0 and 102", peer.RxRate, peer.TxRate, peer.HandshakeAge)
+	}
+	if peer := interfaces[1].Peers[0]; peer.RxRate != 0 || peer.TxRate != 0 {
+		t.Errorf("peer-c: got rx %v tx %v MB/s, want 0", peer.RxRate, peer.TxRate)
+	}
+	// removed peers are forgotten
+	if _, ok := current["wg0 peer-b"]; ok || len(current) != 2 {
+		t.Errorf("got counters %v, want peer-a and peer-c", current)
+	}
+}
@@ -3,7 +3,9 @@ package alerts
 
 import (
 	"beszel/internal/entities/system"
+	"beszel/internal/records"
 	"fmt"
+	"math"
 	"net/mail"
 	"net/url"
 	"strings"
@@ -38,18 +40,23 @@ type UserNotificationSettings struct {
 }
 
 type SystemAlertStats struct {
-	Cpu          float64            `json:"cpu"`
-	Mem          float64            `json:"mp"`
-	Disk         float64            `json:"dp"`
-	NetSent      float64            `json:"ns"`
-	NetRecv      float64            `json:"nr"`
-	Temperatures map[string]float32 `json:"t"`
+	Cpu          float64                    `json:"cpu"`
+	Mem          float64                    `json:"mp"`
+	Disk         float64                    `json:"dp"`
+	NetSent      float64                    `json:"ns"`
+	NetRecv      float64                    `json:"nr"`
+	Temperatures map[string]float32         `json:"t"`
+	Custom       map[string]float64         `json:"cu"`
+	LogMatches   map[string]system.LogMatch `json:"lm"`
+	ClockOffset  float64                    `json:"co"`
+	ClockDrift   float64                    `json:"cd"`
 }
 
 type SystemAlertData struct {
 	systemRecord *core.Record
 	alertRecord  *core.Record
 	name         string
+	target       string // custom metric key or log pattern name
 	unit         string
 	val          float64
 	threshold    float64
@@ -59,6 +66,7 @@ type SystemAlertData struct {
 	min          uint8
 	mapSums      map[string]float32
 	descriptor   string // override descriptor in notification body (for temp sensor, disk partition, etc)
+	detail       string // extra line added to notification body
 }
 
 func NewAlertManager(app *pocketbase.PocketBase) *AlertManager {
@@ -67,7 +75,10 @@ func NewAlertManager(app *pocketbase.PocketBase) *AlertManager {
 	}
 }
 
-func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo system.Info, temperatures map[string]float64, extraFs map[string]*system.FsStats) error {
+func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo system.Info, systemStats system.Stats) error {
+	temperatures := systemStats.Temperatures
+	extraFs := systemStats.ExtraFs
+
 	// start := time.Now()
 	// defer func() {
 	// 	log.Println("alert stats took", time.Since(start))
@@ -86,7 +97,9 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 
 	for _, alertRecord := range alertRecords {
 		name := alertRecord.GetString("name")
+		target := alertRecord.GetString("target")
 		var val float64
+		var detail string
 		unit := "%"
 
 		switch name {
@@ -116,6 +129,29 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 				}
 			}
 			unit = "°C"
+		case "Custom":
+			value, ok := systemStats.Custom[target]
+			if !ok {
+				continue
+			}
+			val = value
+			unit = ""
+		case "Log":
+			match, ok := systemStats.LogMatches[target]
+			if !ok {
+				continue
+			}
+			val = match.Count
+			unit = ""
+			if match.LastLine != "" {
+				detail = "Last match: " + match.LastLine
+			}
+		case "Clock":
+			val = clockDrift(systemStats.ClockOffset, systemStats.ClockDrift)
+			unit = " ms"
+		default:
+			// other alerts are handled separately
+			continue
 		}
 
 		triggered := alertRecord.GetBool("triggered")
@@ -140,6 +176,8 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 			systemRecord: systemRecord,
 			alertRecord:  alertRecord,
 			name:         name,
+			target:       target,
+			detail:       detail,
 			unit:         unit,
 			val:          val,
 			threshold:    threshold,
@@ -149,7 +187,7 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 		})
 	}
 
-	systemStats := []struct {
+	statsRecords := []struct {
 		Stats   []byte         `db:"stats"`
 		Created types.DateTime `db:"created"`
 	}{}
@@ -158,22 +196,28 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 		Select("stats", "created").
 		From("system_stats").
 		Where(dbx.NewExp(
-			"system={:system} AND type='1m' AND created > {:created}",
+			"system={:system} AND type={:type} AND created > {:created}",
 			dbx.Params{
 				"system": systemRecord.Id,
+				// use the records saved on every poll so alerts follow the system's interval
+				"type": records.PollRecordType(systemRecord),
 				// subtract some time to give us a bit of buffer
 				"created": oldestTime.Add(-time.Second * 90),
 			},
 		)).
 		OrderBy("created").
-		All(&systemStats)
+		All(&statsRecords)
 
 	if err != nil {
 		return err
 	}
+	// no records yet, e.g. the first poll of a new system
+	if len(statsRecords) == 0 {
+		return nil
+	}
 
 	// get oldest record creation time from first record in the slice
-	oldestRecordTime := systemStats[0].Created.Time()
+	oldestRecordTime := statsRecords[0].Created.Time()
 	// log.Println("oldestRecordTime", oldestRecordTime.String())
 
 	// delete from validAlerts if time is older than oldestRecord
@@ -192,10 +236,12 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 	var stats SystemAlertStats
 
 	// we can skip the latest systemStats record since it's the current value
-	for i := 0; i < len(systemStats); i++ {
-		stat := systemStats[i]
+	for i := 0; i < len(statsRecords); i++ {
+		stat := statsRecords[i]
 		// subtract 10 seconds to give a small time buffer
 		systemStatsCreation := stat.Created.Time().Add(-time.Second * 10)
+		stats.Custom, stats.LogMatches = nil, nil
+		stats.ClockOffset, stats.ClockDrift = 0, 0
 		if err := json.Unmarshal(stat.Stats, &stats); err != nil {
 			return err
 		}
@@ -244,6 +290,20 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 					}
 					alert.mapSums[key] += temp
 				}
+			case "Custom":
+				value, ok := stats.Custom[alert.target]
+				if !ok {
+					continue
+				}
+				alert.val += value
+			case "Log":
+				match, ok := stats.LogMatches[alert.target]
+				if !ok {
+					continue
+				}
+				alert.val += match.Count
+			case "Clock":
+				alert.val += clockDrift(stats.ClockOffset, stats.ClockDrift)
 			default:
 				continue
 			}
@@ -276,7 +336,7 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 		default:
 			alert.val = alert.val / float64(alert.count)
 		}
-		minCount := float32(alert.min) / 1.2
+		minCount := minRecordCount(alert.systemRecord, alert.min)
 		// log.Println("alert", alert.name, "val", alert.val, "threshold", alert.threshold, "triggered", alert.triggered)
 		// log.Printf("%s: val %f | count %d | min-count %f | threshold %f\n", alert.name, alert.val, alert.count, minCount, alert.threshold)
 		// pass through alert if count is greater than or equal to minCount
@@ -293,18 +353,36 @@ func (am *AlertManager) HandleSystemAlerts(systemRecord *core.Record, systemInfo
 	return nil
 }
 
+// Returns the number of poll records needed to evaluate an alert over min
+// minutes, with some allowance for missed polls
+func minRecordCount(systemRecord *core.Record, min uint8) float32 {
+	return float32(time.Duration(min)*time.Minute) / float32(records.PollInterval(systemRecord)) / 1.2
+}
+
 func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 	// log.Printf("Sending alert %s: val %f | count %d | threshold %f\n", alert.name, alert.val, alert.count, alert.threshold)
 	systemName := alert.systemRecord.GetString("name")
 
-	// change Disk to Disk usage
-	if alert.name == "Disk" {
+	// change Disk to Disk usage and Clock to Clock drift
+	switch alert.name {
+	case "Disk":
 		alert.name += " usage"
+	case "Clock":
+		alert.name += " drift"
 	}
 
-	// make title alert name lowercase if not CPU
+	// use metric key / pattern name as the name of custom and log alerts
+	switch alert.name {
+	case "Custom":
+		alert.name = alert.target
+	case "Log":
+		alert.name = alert.target
+		alert.descriptor = fmt.Sprintf("Matches of %s", alert.target)
+	}
+
+	// make title alert name lowercase if not CPU or custom metric
 	titleAlertName := alert.name
-	if titleAlertName != "CPU" {
+	if titleAlertName != "CPU" && titleAlertName != alert.target {
 		titleAlertName = strings.ToLower(titleAlertName)
 	}
 
@@ -322,6 +400,9 @@ func (am *AlertManager) sendSystemAlert(alert SystemAlertData) {
 		alert.descriptor = alert.name
 	}
 	body := fmt.Sprintf("%s averaged %.2f%s for the previous %v %s.", alert.descriptor, alert.val, alert.unit, alert.min, minutesLabel)
+	if alert.detail != "" {
+		body += "\n\n" + alert.detail
+	}
 
 	alert.alertRecord.Set("triggered", alert.triggered)
 	if err := am.app.Save(alert.alertRecord); err != nil {
@@ -527,3 +608,9 @@ func (am *AlertManager) SendTestNotification(e *core.RequestEvent) error {
 	}
 	return e.JSON(200, map[string]bool{"err": false})
 }
+
+// Returns the larger absolute clock difference in milliseconds, either the
+// offset from NTP time reported by the agent or the drift from the hub's clock
+func clockDrift(offset, drift float64) float64 {
+	return max(math.Abs(offset), math.Abs(drift))
+}
@@ -0,0 +1,102 @@
+//go:build !goexperiment.jsonv2
+
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/records"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestHandleSystemAlertsInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int // seconds between polls, zero for the default
+		polls    int // saved polls in the last ten minutes
+		want     bool
+	}{
+		{name: "default interval", polls: 10, want: true},
+		{name: "default interval with missing polls", polls: 5, want: false},
+		{name: "two minute interval", interval: 120, polls: 5, want: true},
+		{name: "ten minute interval", interval: 600, polls: 1, want: true},
+		{name: "thirty second interval", interval: 30, polls: 20, want: true},
+		{name: "thirty second interval with missing polls", interval: 30, polls: 10, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+			if tt.interval > 0 {
+				systemRecord.Set("interval", tt.interval)
+				if err := app.Save(systemRecord); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			systemStats, err := app.FindCollectionByNameOrId("system_stats")
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := systemRecord.GetDateTime("updated").Time()
+			interval := records.PollInterval(systemRecord)
+			// a poll from before the alert period, then the polls within it
+			polls := []time.Time{now.Add(-10*time.Minute - 30*time.Second)}
+			for i := range tt.polls {
+				polls = append(polls, now.Add(-time.Duration(i)*interval+time.Second))
+			}
+			for _, pollTime := range polls {
+				record := core.NewRecord(systemStats)
+				record.Set("system", systemRecord.Id)
+				record.Set("type", records.PollRecordType(systemRecord))
+				record.Set("stats", system.Stats{Cpu: 80})
+				created, _ := types.ParseDateTime(pollTime)
+				record.SetRaw("created", created)
+				record.SetRaw("updated", created)
+				if err := app.SaveNoValidate(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "CPU")
+			alert.Set("value", 50)
+			alert.Set("min", 10)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewAlertManager(app).HandleSystemAlerts(systemRecord, system.Info{Cpu: 80}, system.Stats{Cpu: 80}); err != nil {
+				t.Fatal(err)
+			}
+
+			// alerts are sent in the background
+			triggered := false
+			for deadline := time.Now().Add(2 * time.Second); tt.want && !triggered && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+				alert, err = app.FindRecordById(alerts, alert.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				triggered = alert.GetBool("triggered")
+			}
+			if !tt.want {
+				alert, _ = app.FindRecordById(alerts, alert.Id)
+				triggered = alert.GetBool("triggered")
+			}
+			if triggered != tt.want {
+				t.Errorf("triggered = %v, want %v", triggered, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package alerts
+
+import (
+	"beszel/internal/certs"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleCertificateAlerts triggers "Certificate" alerts when a certificate for the
+// system expires in fewer days than the alert value, and resolves them once
+// the certificate is renewed. If the alert has a target, only the certificate
+// with that name is considered.
+func (am *AlertManager) HandleCertificateAlerts(systemRecord *core.Record) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "Certificate"},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+	certRecords, err := am.app.FindAllRecords("certificates",
+		dbx.HashExp{"system": systemRecord.Id},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, alertRecord := range alertRecords {
+		target := alertRecord.GetString("target")
+		threshold := alertRecord.GetFloat("value")
+		triggered := alertRecord.GetBool("triggered")
+
+		var expiring []string
+		for _, certRecord := range certRecords {
+			name := certRecord.GetString("name")
+			expires := certRecord.GetDateTime("expires")
+			// skip certificates that couldn't be read
+			if (target != "" && target != name) || expires.IsZero() {
+				continue
+			}
+			if daysLeft := certs.DaysLeft(expires.Time()); daysLeft < threshold {
+				expiring = append(expiring, describeCertificate(certRecord, daysLeft))
+			}
+		}
+
+		switch {
+		case !triggered && len(expiring) > 0:
+			am.sendCertificateAlert(systemRecord, alertRecord, true, expiring)
+		case triggered && len(expiring) == 0:
+			am.sendCertificateAlert(systemRecord, alertRecord, false, nil)
+		}
+	}
+	return nil
+}
+
+// Returns a line describing the certificate expiry for the alert body
+func describeCertificate(certRecord *core.Record, daysLeft float64) string {
+	name := certRecord.GetString("name")
+	expires := certRecord.GetDateTime("expires").Time().Format("2006-01-02")
+	var desc string
+	if daysLeft < 0 {
+		desc = fmt.Sprintf("%s expired %s ago (%s)", name, days(math.Abs(math.Floor(daysLeft))), expires)
+	} else {
+		desc = fmt.Sprintf("%s expires in %s (%s)", name, days(math.Floor(daysLeft)), expires)
+	}
+	if issuer := certRecord.GetString("issuer"); issuer != "" {
+		desc += ", issued by " + issuer
+	}
+	return desc
+}
+
+// Returns the number of whole days with the unit, e.g. "1 day" or "3 days"
+func days(n float64) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%.0f days", n)
+}
+
+func (am *AlertManager) sendCertificateAlert(systemRecord, alertRecord *core.Record, triggered bool, expiring []string) {
+	systemName := systemRecord.GetString("name")
+	alertRecord.Set("triggered", triggered)
+	if err := am.app.Save(alertRecord); err != nil {
+		am.app.Logger().Error("Failed to save alert record", "err", err.Error())
+		return
+	}
+	if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+		return
+	}
+	user := alertRecord.ExpandedOne("user")
+	if user == nil {
+		return
+	}
+
+	var title, message string
+	if triggered {
+		title = fmt.Sprintf("%s certificate expiring", systemName)
+		message = strings.Join(expiring, "\n")
+	} else {
+		title = fmt.Sprintf("%s certificate renewed", systemName)
+		message = fmt.Sprintf("Certificates on %s expire in more than %v days.", systemName, alertRecord.GetFloat("value"))
+	}
+
+	am.sendAlert(AlertMessageData{
+		UserID:   user.Id,
+		Title:    title,
+		Message:  message,
+		Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+		LinkText: "View " + systemName,
+	})
+}
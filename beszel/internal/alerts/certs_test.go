@@ -0,0 +1,108 @@
+//go:build !goexperiment.jsonv2
+
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestDescribeCertificate(t *testing.T) {
+	app := newTestApp(t)
+	collection, err := app.FindCollectionByNameOrId("certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		issuer   string
+		daysLeft float64
+		want     string
+	}{
+		{name: "expires tomorrow", daysLeft: 1.5, want: "example.com:443 expires in 1 day (2026-03-01)"},
+		{name: "expiring", issuer: "R11", daysLeft: 5.7, want: "example.com:443 expires in 5 days (2026-03-01), issued by R11"},
+		{name: "expires today", daysLeft: 0.4, want: "example.com:443 expires in 0 days (2026-03-01)"},
+		{name: "expired", issuer: "R11", daysLeft: -2.3, want: "example.com:443 expired 3 days ago (2026-03-01), issued by R11"},
+		{name: "expired today", daysLeft: -0.2, want: "example.com:443 expired 1 day ago (2026-03-01)"},
+	}
+	for _, tt := range tests {
+		record := core.NewRecord(collection)
+		record.Set("name", "example.com:443")
+		record.Set("issuer", tt.issuer)
+		record.Set("expires", expires)
+		if got := describeCertificate(record, tt.daysLeft); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleCertificateAlerts(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		triggered bool                     // alert state before the check
+		expires   map[string]time.Duration // certificates by name, expiring after the duration
+		want      bool                     // alert state after the check
+	}{
+		{name: "expiring", expires: map[string]time.Duration{"a": 5 * 24 * time.Hour}, want: true},
+		{name: "expired", expires: map[string]time.Duration{"a": -24 * time.Hour}, want: true},
+		{name: "not expiring", expires: map[string]time.Duration{"a": 60 * 24 * time.Hour}, want: false},
+		{name: "other target expiring", target: "b", expires: map[string]time.Duration{"a": 5 * 24 * time.Hour, "b": 60 * 24 * time.Hour}, want: false},
+		{name: "renewed", triggered: true, expires: map[string]time.Duration{"a": 60 * 24 * time.Hour}, want: false},
+		{name: "unreadable certificates are skipped", expires: map[string]time.Duration{"a": 0}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+
+			certificates, err := app.FindCollectionByNameOrId("certificates")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expires := range tt.expires {
+				record := core.NewRecord(certificates)
+				record.Set("system", systemRecord.Id)
+				record.Set("name", name)
+				record.Set("source", "agent")
+				if expires != 0 {
+					record.Set("expires", time.Now().Add(expires))
+				}
+				if err := app.SaveNoValidate(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "Certificate")
+			alert.Set("target", tt.target)
+			alert.Set("value", 14)
+			alert.Set("triggered", tt.triggered)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewAlertManager(app).HandleCertificateAlerts(systemRecord); err != nil {
+				t.Fatal(err)
+			}
+
+			alert, err = app.FindRecordById(alerts, alert.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := alert.GetBool("triggered"); got != tt.want {
+				t.Errorf("triggered = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package alerts
+
+import (
+	"beszel/internal/entities/check"
+	"beszel/internal/records"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cast"
+)
+
+// HandleCheckAlerts triggers "Service" alerts when a service check has failed
+// in every poll for the alert's time period, and resolves them once the check
+// succeeds again. If the alert has a target, only the check with that name is
+// considered, otherwise all checks on the system are. Alerts for checks that
+// are no longer reported are resolved.
+func (am *AlertManager) HandleCheckAlerts(systemRecord *core.Record, checks []*check.Stats) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "Service"},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+
+	now := systemRecord.GetDateTime("updated").Time().UTC()
+	oldestTime := now
+	for _, alertRecord := range alertRecords {
+		min := max(1, cast.ToUint8(alertRecord.Get("min")))
+		if t := now.Add(-time.Duration(min) * time.Minute); t.Before(oldestTime) {
+			oldestTime = t
+		}
+	}
+
+	checkRecords := []struct {
+		Stats   []byte         `db:"stats"`
+		Created types.DateTime `db:"created"`
+	}{}
+	err = am.app.DB().
+		Select("stats", "created").
+		From("check_stats").
+		Where(dbx.NewExp(
+			"system={:system} AND type={:type} AND created > {:created}",
+			dbx.Params{
+				"system":  systemRecord.Id,
+				"type":    records.PollRecordType(systemRecord),
+				"created": oldestTime.Add(-time.Second * 90),
+			},
+		)).
+		OrderBy("created").
+		All(&checkRecords)
+	if err != nil {
+		return err
+	}
+
+	// decode records once, they're shared between alerts
+	history := make([][]check.Stats, len(checkRecords))
+	for i := range checkRecords {
+		if err := json.Unmarshal(checkRecords[i].Stats, &history[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, alertRecord := range alertRecords {
+		target := alertRecord.GetString("target")
+		triggered := alertRecord.GetBool("triggered")
+		min := max(1, cast.ToUint8(alertRecord.Get("min")))
+		alertTime := now.Add(-time.Duration(min) * time.Minute)
+
+		if triggered {
+			// resolve once every matching check is up again
+			stillDown := false
+			for _, c := range checks {
+				if checkMatches(target, c.Name) && c.Up < 1 {
+					stillDown = true
+					break
+				}
+			}
+			if !stillDown {
+				am.sendCheckAlert(systemRecord, alertRecord, false, nil, min)
+			}
+			continue
+		}
+
+		// count polls and failures for each matching check within the alert period
+		total := make(map[string]uint8)
+		down := make(map[string]uint8)
+		for i := range history {
+			// subtract 10 seconds to give a small time buffer
+			if checkRecords[i].Created.Time().Add(-time.Second * 10).Before(alertTime) {
+				continue
+			}
+			for _, c := range history[i] {
+				if !checkMatches(target, c.Name) {
+					continue
+				}
+				total[c.Name]++
+				if c.Up < 1 {
+					down[c.Name]++
+				}
+			}
+		}
+
+		minCount := minRecordCount(systemRecord, min)
+		var failing []*check.Stats
+		for _, c := range checks {
+			name := c.Name
+			if checkMatches(target, name) && c.Up < 1 && float32(total[name]) >= minCount && down[name] == total[name] {
+				failing = append(failing, c)
+			}
+		}
+		if len(failing) > 0 {
+			am.sendCheckAlert(systemRecord, alertRecord, true, failing, min)
+		}
+	}
+	return nil
+}
+
+// Returns true if the check name matches the alert target (empty target matches all checks)
+func checkMatches(target, name string) bool {
+	return target == "" || target == name
+}
+
+func (am *AlertManager) sendCheckAlert(systemRecord, alertRecord *core.Record, triggered bool, failing []*check.Stats, min uint8) {
+	systemName := systemRecord.GetString("name")
+	alertRecord.Set("triggered", triggered)
+	if err := am.app.Save(alertRecord); err != nil {
+		am.app.Logger().Error("Failed to save alert record", "err", err.Error())
+		return
+	}
+	if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+		return
+	}
+	user := alertRecord.ExpandedOne("user")
+	if user == nil {
+		return
+	}
+
+	checkName := alertRecord.GetString("target")
+	if checkName == "" {
+		checkName = "services"
+	}
+
+	var title, message string
+	if triggered {
+		names := make([]string, 0, len(failing))
+		details := make([]string, 0, len(failing))
+		for _, c := range failing {
+			names = append(names, c.Name)
+			details = append(details, fmt.Sprintf("%s (%s): %s", c.Name, c.Type, c.Error))
+		}
+		minutesLabel := "minute"
+		if min > 1 {
+			minutesLabel += "s"
+		}
+		title = fmt.Sprintf("%s %s down \U0001F534", systemName, strings.Join(names, ", "))
+		message = fmt.Sprintf("Service checks failed for the previous %v %s.\n\n%s", min, minutesLabel, strings.Join(details, "\n"))
+	} else {
+		title = fmt.Sprintf("%s %s up ✅", systemName, checkName)
+		message = fmt.Sprintf("Service checks on %s are passing again.", systemName)
+	}
+
+	am.sendAlert(AlertMessageData{
+		UserID:   user.Id,
+		Title:    title,
+		Message:  message,
+		Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+		LinkText: "View " + systemName,
+	})
+}
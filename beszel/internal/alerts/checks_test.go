@@ -0,0 +1,186 @@
+//go:build !goexperiment.jsonv2
+
+// PocketBase collections don't decode with encoding/json v2, so these tests
+// only build with the json package of Go 1.23 or GOEXPERIMENT=nojsonv2.
+
+package alerts
+
+import (
+	"beszel/internal/entities/check"
+	_ "beszel/migrations"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Creates an app with a migrated database in a temporary directory
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	return app
+}
+
+// Creates a user and a system the user can see
+func createTestSystem(t *testing.T, app core.App) (user, systemRecord *core.Record) {
+	t.Helper()
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user = core.NewRecord(users)
+	user.SetEmail("test@example.com")
+	user.SetPassword("testpassword")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	systems, err := app.FindCollectionByNameOrId("systems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemRecord = core.NewRecord(systems)
+	systemRecord.Set("name", "test")
+	systemRecord.Set("host", "127.0.0.1")
+	systemRecord.Set("port", "45876")
+	systemRecord.Set("status", "up")
+	systemRecord.Set("users", user.Id)
+	if err := app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	return user, systemRecord
+}
+
+func TestHandleCheckAlerts(t *testing.T) {
+	down := check.Stats{Name: "api", Type: check.TypeHttp, Status: 500, Error: "unexpected status 500"}
+	up := check.Stats{Name: "api", Type: check.TypeHttp, Up: 1, Status: 200}
+	db := check.Stats{Name: "db", Type: check.TypeTcp, Up: 1}
+
+	tests := []struct {
+		name      string
+		target    string
+		triggered bool            // alert state before the poll
+		history   [][]check.Stats // saved polls, oldest first, one minute apart
+		checks    []check.Stats   // checks reported by the current poll
+		want      bool            // alert state after the poll
+	}{
+		{
+			name:    "down for the whole period",
+			history: [][]check.Stats{{down, db}, {down, db}},
+			checks:  []check.Stats{down, db},
+			want:    true,
+		},
+		{
+			name:    "up during the period",
+			history: [][]check.Stats{{up, db}, {down, db}},
+			checks:  []check.Stats{down, db},
+			want:    false,
+		},
+		{
+			name:    "not enough polls",
+			history: [][]check.Stats{{down, db}},
+			checks:  []check.Stats{down, db},
+			want:    false,
+		},
+		{
+			name:    "other target down",
+			target:  "db",
+			history: [][]check.Stats{{down, db}, {down, db}},
+			checks:  []check.Stats{down, db},
+			want:    false,
+		},
+		{
+			name:      "still down",
+			triggered: true,
+			history:   [][]check.Stats{{down}, {down}},
+			checks:    []check.Stats{down},
+			want:      true,
+		},
+		{
+			name:      "back up",
+			triggered: true,
+			history:   [][]check.Stats{{down}, {down}},
+			checks:    []check.Stats{up},
+			want:      false,
+		},
+		{
+			name:      "check removed",
+			triggered: true,
+			history:   [][]check.Stats{{down}, {down}},
+			checks:    nil,
+			want:      false,
+		},
+		{
+			name:      "target removed",
+			target:    "api",
+			triggered: true,
+			history:   [][]check.Stats{{down, db}, {down, db}},
+			checks:    []check.Stats{db},
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+
+			checkStats, err := app.FindCollectionByNameOrId("check_stats")
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := systemRecord.GetDateTime("updated").Time()
+			for i, stats := range tt.history {
+				record := core.NewRecord(checkStats)
+				record.Set("system", systemRecord.Id)
+				record.Set("type", "1m")
+				record.Set("stats", stats)
+				created, _ := types.ParseDateTime(now.Add(-time.Duration(len(tt.history)-i) * time.Minute).Add(20 * time.Second))
+				record.SetRaw("created", created)
+				record.SetRaw("updated", created)
+				if err := app.SaveNoValidate(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "Service")
+			alert.Set("target", tt.target)
+			alert.Set("min", 2)
+			alert.Set("triggered", tt.triggered)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			checks := make([]*check.Stats, len(tt.checks))
+			for i := range tt.checks {
+				checks[i] = &tt.checks[i]
+			}
+			if err := NewAlertManager(app).HandleCheckAlerts(systemRecord, checks); err != nil {
+				t.Fatal(err)
+			}
+
+			alert, err = app.FindRecordById(alerts, alert.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := alert.GetBool("triggered"); got != tt.want {
+				t.Errorf("triggered = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleLoginAlerts sends a notification for "Login" alerts when a session
+// started after the previous update comes from a source not listed in the
+// alert target. The target is a comma separated list of addresses, CIDR ranges
+// or host names; if it's empty, every remote login is reported. Local logins
+// (no source host) are never reported.
+func (am *AlertManager) HandleLoginAlerts(systemRecord *core.Record, sessions []system.Session, since time.Time) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "Login"},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+
+	systemName := systemRecord.GetString("name")
+	for _, alertRecord := range alertRecords {
+		known := strings.Split(alertRecord.GetString("target"), ",")
+		var lines []string
+		for _, session := range sessions {
+			if session.Host == "" || !session.Started.After(since) || isKnownSource(session.Host, known) {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s on %s from %s at %s", session.User, session.Tty, session.Host, session.Started.Format(time.RFC3339)))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+			continue
+		}
+		user := alertRecord.ExpandedOne("user")
+		if user == nil {
+			continue
+		}
+		am.sendAlert(AlertMessageData{
+			UserID:   user.Id,
+			Title:    fmt.Sprintf("Login from unknown source on %s", systemName),
+			Message:  strings.Join(lines, "\n"),
+			Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+			LinkText: "View " + systemName,
+		})
+	}
+	return nil
+}
+
+// Returns true if the host matches one of the known addresses, CIDR ranges or names
+func isKnownSource(host string, known []string) bool {
+	// utmp may include the display number for X sessions, e.g. "10.0.0.5:0"
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	for _, source := range known {
+		source = strings.TrimSpace(source)
+		switch {
+		case source == "":
+			continue
+		case strings.EqualFold(source, host):
+			return true
+		case ip != nil && strings.Contains(source, "/"):
+			if _, network, err := net.ParseCIDR(source); err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+//go:build !goexperiment.jsonv2
+
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Sends the user's notifications to a webhook and returns a function that
+// returns the messages received so far
+func captureAlerts(t *testing.T, app core.App, user *core.Record) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		messages = append(messages, string(body))
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	collection, err := app.FindCollectionByNameOrId("user_settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := core.NewRecord(collection)
+	settings.Set("user", user.Id)
+	settings.Set("settings", UserNotificationSettings{
+		Webhooks: []string{"generic://" + strings.TrimPrefix(server.URL, "http://") + "/alert?disabletls=yes"},
+	})
+	if err := app.Save(settings); err != nil {
+		t.Fatal(err)
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), messages...)
+	}
+}
+
+func TestHandleLoginAlerts(t *testing.T) {
+	since := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := func(user, host string, minutes int) system.Session {
+		return system.Session{User: user, Tty: "pts/0", Host: host, Started: since.Add(time.Duration(minutes) * time.Minute)}
+	}
+	tests := []struct {
+		name     string
+		target   string
+		sessions []system.Session
+		want     []string // users reported, empty if no alert is sent
+	}{
+		{name: "remote login", sessions: []system.Session{session("alice", "203.0.113.5", 1)}, want: []string{"alice"}},
+		{name: "local login", sessions: []system.Session{session("alice", "", 1)}},
+		{name: "session started before the poll", sessions: []system.Session{session("alice", "203.0.113.5", -1), session("bob", "203.0.113.6", 0)}},
+		{name: "known address", target: "203.0.113.5", sessions: []system.Session{session("alice", "203.0.113.5", 1)}},
+		{name: "known range", target: "10.0.0.0/8, 203.0.113.0/24", sessions: []system.Session{session("alice", "203.0.113.5", 1)}},
+		{name: "known host name", target: "Bastion.example.com", sessions: []system.Session{session("alice", "bastion.example.com", 1)}},
+		{name: "display number", target: "10.0.0.5", sessions: []system.Session{session("alice", "10.0.0.5:0", 1)}},
+		{name: "unknown among known", target: "10.0.0.0/8", sessions: []system.Session{session("alice", "10.1.2.3", 1), session("bob", "198.51.100.7", 2)}, want: []string{"bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+			received := captureAlerts(t, app, user)
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "Login")
+			alert.Set("target", tt.target)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewAlertManager(app).HandleLoginAlerts(systemRecord, tt.sessions, since); err != nil {
+				t.Fatal(err)
+			}
+			messages := received()
+			if len(tt.want) == 0 {
+				if len(messages) > 0 {
+					t.Errorf("got alerts %q, want none", messages)
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("got %d alerts, want 1", len(messages))
+			}
+			for _, session := range tt.sessions {
+				reported := strings.Contains(messages[0], session.User+" on ")
+				if want := strings.Contains(strings.Join(tt.want, " "), session.User); reported != want {
+					t.Errorf("%s reported = %v, want %v in %q", session.User, reported, want, messages[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandlePortAlerts sends a notification for each "Port" alert of the system
+// when new externally bound ports appear. Port alerts have no resolved state,
+// so the alert is not marked as triggered.
+func (am *AlertManager) HandlePortAlerts(systemRecord *core.Record, ports []system.ListeningPort) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "Port"},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+
+	systemName := systemRecord.GetString("name")
+	lines := make([]string, 0, len(ports))
+	for _, port := range ports {
+		line := port.Protocol + " " + net.JoinHostPort(port.Address, strconv.Itoa(int(port.Port)))
+		if port.Process != "" {
+			line += " (" + port.Process + ")"
+		}
+		lines = append(lines, line)
+	}
+
+	for _, alertRecord := range alertRecords {
+		if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+			continue
+		}
+		user := alertRecord.ExpandedOne("user")
+		if user == nil {
+			continue
+		}
+		am.sendAlert(AlertMessageData{
+			UserID:   user.Id,
+			Title:    fmt.Sprintf("New port opened on %s", systemName),
+			Message:  strings.Join(lines, "\n"),
+			Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+			LinkText: "View " + systemName,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net/url"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleUpdateAlerts triggers "Updates" alerts when the number of pending
+// security updates is greater than the alert value, and resolves them once
+// the updates are installed. Alerts are skipped until the agent has checked
+// for updates, so an agent restart doesn't resolve them.
+func (am *AlertManager) HandleUpdateAlerts(systemRecord *core.Record, systemInfo system.Info) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "Updates"},
+	)
+	if err != nil || len(alertRecords) == 0 || systemInfo.Updates == nil || systemInfo.SecurityUpdates == nil {
+		return nil
+	}
+	val := float64(*systemInfo.SecurityUpdates)
+	for _, alertRecord := range alertRecords {
+		triggered := alertRecord.GetBool("triggered")
+		threshold := alertRecord.GetFloat("value")
+		switch {
+		case !triggered && val > threshold:
+			am.sendUpdateAlert(systemRecord, alertRecord, true, systemInfo)
+		case triggered && val <= threshold:
+			am.sendUpdateAlert(systemRecord, alertRecord, false, systemInfo)
+		}
+	}
+	return nil
+}
+
+func (am *AlertManager) sendUpdateAlert(systemRecord, alertRecord *core.Record, triggered bool, systemInfo system.Info) {
+	systemName := systemRecord.GetString("name")
+	alertRecord.Set("triggered", triggered)
+	if err := am.app.Save(alertRecord); err != nil {
+		am.app.Logger().Error("Failed to save alert record", "err", err.Error())
+		return
+	}
+	if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+		return
+	}
+	user := alertRecord.ExpandedOne("user")
+	if user == nil {
+		return
+	}
+
+	var title, message string
+	if triggered {
+		title = fmt.Sprintf("%s has pending security updates", systemName)
+		message = fmt.Sprintf("%d security updates are pending (%d updates total).", *systemInfo.SecurityUpdates, *systemInfo.Updates)
+	} else {
+		title = fmt.Sprintf("%s security updates installed", systemName)
+		message = fmt.Sprintf("%d security updates are pending.", *systemInfo.SecurityUpdates)
+	}
+	if systemInfo.RebootRequired {
+		message += " A reboot is required."
+	}
+
+	am.sendAlert(AlertMessageData{
+		UserID:   user.Id,
+		Title:    title,
+		Message:  message,
+		Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+		LinkText: "View " + systemName,
+	})
+}
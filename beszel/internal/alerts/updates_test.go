@@ -0,0 +1,60 @@
+//go:build !goexperiment.jsonv2
+
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestHandleUpdateAlerts(t *testing.T) {
+	count := func(n int) *int { return &n }
+	tests := []struct {
+		name      string
+		triggered bool // alert state before the poll
+		info      system.Info
+		want      bool // alert state after the poll
+	}{
+		{name: "security updates", info: system.Info{Updates: count(5), SecurityUpdates: count(2)}, want: true},
+		{name: "only other updates", info: system.Info{Updates: count(5), SecurityUpdates: count(0)}, want: false},
+		{name: "still pending", triggered: true, info: system.Info{Updates: count(5), SecurityUpdates: count(2)}, want: true},
+		{name: "installed", triggered: true, info: system.Info{Updates: count(0), SecurityUpdates: count(0)}, want: false},
+		{name: "not checked yet", triggered: true, info: system.Info{}, want: true},
+		{name: "not checked yet and not triggered", info: system.Info{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "Updates")
+			alert.Set("value", 0)
+			alert.Set("triggered", tt.triggered)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewAlertManager(app).HandleUpdateAlerts(systemRecord, tt.info); err != nil {
+				t.Fatal(err)
+			}
+
+			alert, err = app.FindRecordById(alerts, alert.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := alert.GetBool("triggered"); got != tt.want {
+				t.Errorf("triggered = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// HandleVpnAlerts triggers "VPN" alerts when a WireGuard peer's latest handshake
+// is older than the alert value in minutes, or the peer never completed one,
+// and resolves them once all peers have a recent handshake. If the alert has
+// a target, only peers on that interface or with that public key or endpoint
+// are considered.
+func (am *AlertManager) HandleVpnAlerts(systemRecord *core.Record, interfaces []system.WireGuardInterface) error {
+	alertRecords, err := am.app.FindAllRecords("alerts",
+		dbx.HashExp{"system": systemRecord.Id, "name": "VPN"},
+	)
+	if err != nil || len(alertRecords) == 0 {
+		return nil
+	}
+
+	for _, alertRecord := range alertRecords {
+		target := alertRecord.GetString("target")
+		maxAge := int64(alertRecord.GetFloat("value") * 60)
+		triggered := alertRecord.GetBool("triggered")
+
+		var stale []string
+		for _, iface := range interfaces {
+			for _, peer := range iface.Peers {
+				if target != "" && target != iface.Name && target != peer.PublicKey && target != peer.Endpoint {
+					continue
+				}
+				if peer.HandshakeAge >= 0 && peer.HandshakeAge <= maxAge {
+					continue
+				}
+				stale = append(stale, describePeer(iface.Name, peer))
+			}
+		}
+
+		switch {
+		case !triggered && len(stale) > 0:
+			am.sendVpnAlert(systemRecord, alertRecord, true, stale)
+		case triggered && len(stale) == 0:
+			am.sendVpnAlert(systemRecord, alertRecord, false, nil)
+		}
+	}
+	return nil
+}
+
+// Returns a line describing a stale peer for the alert body
+func describePeer(iface string, peer system.WireGuardPeer) string {
+	name := peer.Endpoint
+	if name == "" {
+		name = peer.PublicKey
+	}
+	if peer.HandshakeAge < 0 {
+		return fmt.Sprintf("%s peer %s has no handshake", iface, name)
+	}
+	return fmt.Sprintf("%s peer %s last handshake %d minutes ago", iface, name, peer.HandshakeAge/60)
+}
+
+func (am *AlertManager) sendVpnAlert(systemRecord, alertRecord *core.Record, triggered bool, stale []string) {
+	systemName := systemRecord.GetString("name")
+	alertRecord.Set("triggered", triggered)
+	if err := am.app.Save(alertRecord); err != nil {
+		am.app.Logger().Error("Failed to save alert record", "err", err.Error())
+		return
+	}
+	if errs := am.app.ExpandRecord(alertRecord, []string{"user"}, nil); len(errs) > 0 {
+		return
+	}
+	user := alertRecord.ExpandedOne("user")
+	if user == nil {
+		return
+	}
+
+	var title, message string
+	if triggered {
+		title = fmt.Sprintf("%s VPN peer stale", systemName)
+		message = strings.Join(stale, "\n")
+	} else {
+		title = fmt.Sprintf("%s VPN peers reconnected", systemName)
+		message = fmt.Sprintf("All VPN peers on %s completed a handshake in the last %v minutes.", systemName, alertRecord.GetFloat("value"))
+	}
+
+	am.sendAlert(AlertMessageData{
+		UserID:   user.Id,
+		Title:    title,
+		Message:  message,
+		Link:     am.app.Settings().Meta.AppURL + "/system/" + url.PathEscape(systemName),
+		LinkText: "View " + systemName,
+	})
+}
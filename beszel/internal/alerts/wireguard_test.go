@@ -0,0 +1,102 @@
+//go:build !goexperiment.jsonv2
+
+package alerts
+
+import (
+	"beszel/internal/entities/system"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestHandleVpnAlerts(t *testing.T) {
+	// handshake ages in seconds of peer-a on wg0 and peer-b on wg1
+	interfaces := func(ageA, ageB int64) []system.WireGuardInterface {
+		return []system.WireGuardInterface{
+			{Name: "wg0", Peers: []system.WireGuardPeer{{PublicKey: "peer-a", Endpoint: "203.0.113.5:51820", HandshakeAge: ageA}}},
+			{Name: "wg1", Peers: []system.WireGuardPeer{{PublicKey: "peer-b", HandshakeAge: ageB}}},
+		}
+	}
+	type poll struct {
+		ageA, ageB    int64
+		wantTriggered bool
+		wantMessage   string // part of the message sent by the poll, empty if none
+	}
+	tests := []struct {
+		name   string
+		target string
+		polls  []poll
+	}{
+		{name: "all peers", polls: []poll{
+			{ageA: 60, ageB: 120},
+			{ageA: 60, ageB: 360, wantTriggered: true, wantMessage: "wg1 peer peer-b last handshake 6 minutes ago"},
+			// no repeated alert while still stale
+			{ageA: 400, ageB: 360, wantTriggered: true},
+			{ageA: 60, ageB: 30, wantMessage: "All VPN peers on test completed a handshake in the last 5 minutes"},
+		}},
+		{name: "never connected", polls: []poll{
+			{ageA: 60, ageB: -1, wantTriggered: true, wantMessage: "wg1 peer peer-b has no handshake"},
+		}},
+		{name: "interface target", target: "wg0", polls: []poll{
+			{ageA: 60, ageB: -1},
+			{ageA: 600, ageB: -1, wantTriggered: true, wantMessage: "wg0 peer 203.0.113.5:51820 last handshake 10 minutes ago"},
+		}},
+		{name: "public key target", target: "peer-a", polls: []poll{
+			{ageA: 60, ageB: 600},
+			{ageA: -1, ageB: 600, wantTriggered: true, wantMessage: "wg0 peer 203.0.113.5:51820 has no handshake"},
+		}},
+		{name: "endpoint target", target: "203.0.113.5:51820", polls: []poll{
+			{ageA: 300, ageB: 600},
+			{ageA: 301, ageB: 600, wantTriggered: true, wantMessage: "wg0 peer 203.0.113.5:51820"},
+		}},
+		{name: "unknown target", target: "wg9", polls: []poll{
+			{ageA: -1, ageB: -1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user, systemRecord := createTestSystem(t, app)
+			received := captureAlerts(t, app, user)
+
+			alerts, err := app.FindCollectionByNameOrId("alerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			alert := core.NewRecord(alerts)
+			alert.Set("system", systemRecord.Id)
+			alert.Set("user", user.Id)
+			alert.Set("name", "VPN")
+			alert.Set("value", 5)
+			alert.Set("target", tt.target)
+			if err := app.Save(alert); err != nil {
+				t.Fatal(err)
+			}
+
+			am := NewAlertManager(app)
+			sent := 0
+			for i, p := range tt.polls {
+				if err := am.HandleVpnAlerts(systemRecord, interfaces(p.ageA, p.ageB)); err != nil {
+					t.Fatal(err)
+				}
+				alert, err := app.FindRecordById("alerts", alert.Id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if triggered := alert.GetBool("triggered"); triggered != p.wantTriggered {
+					t.Errorf("poll %d: triggered = %v, want %v", i, triggered, p.wantTriggered)
+				}
+				messages := received()
+				switch {
+				case p.wantMessage == "" && len(messages) != sent:
+					t.Errorf("poll %d: got alert %q, want none", i, messages[sent:])
+				case p.wantMessage != "" && (len(messages) != sent+1 || !strings.Contains(messages[sent], p.wantMessage)):
+					t.Errorf("poll %d: got alerts %q, want one containing %q", i, messages[sent:], p.wantMessage)
+				}
+				sent = len(messages)
+			}
+		})
+	}
+}
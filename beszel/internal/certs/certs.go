@@ -0,0 +1,131 @@
+// Package certs inspects TLS certificates from network endpoints and PEM files.
+package certs
+
+import (
+	"beszel/internal/entities/check"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Inspect returns certificate details for a target, which is either
+// a host:port endpoint or the path to a local PEM file.
+func Inspect(target string, timeout time.Duration) check.Certificate {
+	if IsFile(target) {
+		return InspectFile(target)
+	}
+	return InspectEndpoint(target, timeout)
+}
+
+// IsFile returns true if the target refers to a local file rather than an endpoint
+func IsFile(target string) bool {
+	return strings.HasPrefix(target, "/") || strings.HasPrefix(target, "file://")
+}
+
+// InspectEndpoint connects to host:port and checks the certificate chain it presents.
+// Port 443 is used if the target doesn't include a port.
+func InspectEndpoint(target string, timeout time.Duration) check.Certificate {
+	result := check.Certificate{Name: target}
+
+	addr := target
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+		addr = net.JoinHostPort(target, "443")
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	// verification is done below so we can report details of invalid certificates
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		result.Error = "no certificates presented"
+		return result
+	}
+	verifyChain(&result, chain, host, nil)
+	return result
+}
+
+// InspectFile reads a PEM file and checks the certificate chain it contains.
+// The first certificate in the file is treated as the leaf.
+func InspectFile(path string) check.Certificate {
+	result := check.Certificate{Name: path}
+
+	data, err := os.ReadFile(strings.TrimPrefix(path, "file://"))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		result.Error = "no certificates found in file"
+		return result
+	}
+	verifyChain(&result, chain, "", nil)
+	return result
+}
+
+// Fills in leaf details and verifies the chain against the roots, or the
+// system roots if roots is nil
+func verifyChain(result *check.Certificate, chain []*x509.Certificate, dnsName string, roots *x509.CertPool) {
+	leaf := chain[0]
+	result.Subject = leaf.Subject.CommonName
+	if result.Subject == "" && len(leaf.DNSNames) > 0 {
+		result.Subject = leaf.DNSNames[0]
+	}
+	result.Issuer = leaf.Issuer.CommonName
+	if result.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		result.Issuer = leaf.Issuer.Organization[0]
+	}
+	result.NotAfter = leaf.NotAfter.UTC()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       dnsName,
+		Intermediates: intermediates,
+		Roots:         roots,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.Valid = true
+}
+
+// DaysLeft returns the number of days until the certificate expires (negative if expired)
+func DaysLeft(notAfter time.Time) float64 {
+	return float64(time.Until(notAfter)) / float64(24*time.Hour)
+}
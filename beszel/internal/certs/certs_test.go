@@ -0,0 +1,223 @@
+package certs
+
+import (
+	"beszel/internal/entities/check"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Certificate and key signed by parent, or self-signed if parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(30 * 24 * time.Hour)
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, key: key}
+}
+
+// Returns a root, an intermediate and a leaf certificate for localhost
+func newTestChain(t *testing.T, leafTemplate *x509.Certificate) (root, intermediate, leaf testCert) {
+	t.Helper()
+	root = newTestCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil)
+	intermediate = newTestCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Test Intermediate"}, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, &root)
+	if leafTemplate.Subject.CommonName == "" {
+		leafTemplate.Subject.CommonName = "localhost"
+	}
+	if leafTemplate.DNSNames == nil {
+		leafTemplate.DNSNames = []string{"localhost"}
+	}
+	leafTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	leaf = newTestCert(t, leafTemplate, &intermediate)
+	return root, intermediate, leaf
+}
+
+func TestVerifyChain(t *testing.T) {
+	root, intermediate, leaf := newTestChain(t, &x509.Certificate{})
+	expiredRoot, expiredIntermediate, expired := newTestChain(t, &x509.Certificate{NotBefore: time.Now().Add(-60 * 24 * time.Hour), NotAfter: time.Now().Add(-24 * time.Hour)})
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	roots.AddCert(expiredRoot.cert)
+
+	tests := []struct {
+		name      string
+		chain     []*x509.Certificate
+		dnsName   string
+		roots     *x509.CertPool
+		wantValid bool
+		wantError string
+	}{
+		{name: "valid", chain: []*x509.Certificate{leaf.cert, intermediate.cert}, dnsName: "localhost", roots: roots, wantValid: true},
+		{name: "file without host name", chain: []*x509.Certificate{leaf.cert, intermediate.cert}, roots: roots, wantValid: true},
+		{name: "wrong host name", chain: []*x509.Certificate{leaf.cert, intermediate.cert}, dnsName: "example.com", roots: roots, wantError: "example.com"},
+		{name: "missing intermediate", chain: []*x509.Certificate{leaf.cert}, dnsName: "localhost", roots: roots, wantError: "unknown authority"},
+		{name: "unknown root", chain: []*x509.Certificate{leaf.cert, intermediate.cert}, dnsName: "localhost", wantError: "unknown authority"},
+		{name: "expired", chain: []*x509.Certificate{expired.cert, expiredIntermediate.cert}, dnsName: "localhost", roots: roots, wantError: "expired"},
+	}
+	for _, tt := range tests {
+		var result check.Certificate
+		verifyChain(&result, tt.chain, tt.dnsName, tt.roots)
+		if result.Valid != tt.wantValid || !strings.Contains(result.Error, tt.wantError) {
+			t.Errorf("%s: valid %v error %q, want %v %q", tt.name, result.Valid, result.Error, tt.wantValid, tt.wantError)
+		}
+		if result.Subject != "localhost" || result.Issuer != "Test Intermediate" || !result.NotAfter.Equal(tt.chain[0].NotAfter) {
+			t.Errorf("%s: got details %+v", tt.name, result)
+		}
+	}
+}
+
+func TestVerifyChainSubjectFallbacks(t *testing.T) {
+	leaf := newTestCert(t, &x509.Certificate{
+		Subject:  pkix.Name{Organization: []string{"Acme"}},
+		DNSNames: []string{"www.example.com", "example.com"},
+	}, nil)
+	var result check.Certificate
+	verifyChain(&result, []*x509.Certificate{leaf.cert}, "", nil)
+	if result.Subject != "www.example.com" || result.Issuer != "Acme" {
+		t.Errorf("got subject %q issuer %q", result.Subject, result.Issuer)
+	}
+}
+
+func TestInspectEndpoint(t *testing.T) {
+	_, intermediate, leaf := newTestChain(t, &x509.Certificate{IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}})
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.cert.Raw, intermediate.cert.Raw},
+		PrivateKey:  leaf.key,
+	}}}
+	server.StartTLS()
+	defer server.Close()
+
+	addr := server.Listener.Addr().String()
+	result := InspectEndpoint(addr, 5*time.Second)
+	if result.Name != addr || result.Subject != "localhost" || result.Issuer != "Test Intermediate" || !result.NotAfter.Equal(leaf.cert.NotAfter) {
+		t.Errorf("got %+v", result)
+	}
+	// details are reported for certificates the system doesn't trust
+	if result.Valid || !strings.Contains(result.Error, "unknown authority") {
+		t.Errorf("valid %v error %q, want an unknown authority", result.Valid, result.Error)
+	}
+
+	// the httptest certificate has a different issuer
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	if result := InspectEndpoint(tlsServer.Listener.Addr().String(), 5*time.Second); result.Issuer != "Acme Co" || result.Error == "" {
+		t.Errorf("got %+v", result)
+	}
+
+	// closed port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+	if result := InspectEndpoint(closedAddr, time.Second); result.Error == "" || result.Subject != "" {
+		t.Errorf("closed port: got %+v", result)
+	}
+}
+
+func TestInspectFile(t *testing.T) {
+	_, intermediate, leaf := newTestChain(t, &x509.Certificate{})
+	dir := t.TempDir()
+	var chain []byte
+	for _, cert := range []*x509.Certificate{leaf.cert, intermediate.cert} {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	files := map[string][]byte{
+		"chain.pem": append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}), chain...),
+		"empty.pem": []byte("not a certificate\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "chain.pem")
+	if result := InspectFile("file://" + path); result.Subject != "localhost" || result.Issuer != "Test Intermediate" {
+		t.Errorf("chain: got %+v", result)
+	}
+	if result := InspectFile(filepath.Join(dir, "empty.pem")); result.Error != "no certificates found in file" {
+		t.Errorf("empty: got %+v", result)
+	}
+	if result := InspectFile(filepath.Join(dir, "missing.pem")); result.Error == "" {
+		t.Errorf("missing: got %+v", result)
+	}
+}
+
+func TestDaysLeft(t *testing.T) {
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		want     float64
+	}{
+		{name: "two days", notAfter: time.Now().Add(48 * time.Hour), want: 2},
+		{name: "half a day", notAfter: time.Now().Add(12 * time.Hour), want: 0.5},
+		{name: "expired", notAfter: time.Now().Add(-36 * time.Hour), want: -1.5},
+	}
+	for _, tt := range tests {
+		if got := DaysLeft(tt.notAfter); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsFile(t *testing.T) {
+	for target, want := range map[string]bool{
+		"/etc/ssl/cert.pem":        true,
+		"file:///etc/ssl/cert.pem": true,
+		"example.com:443":          false,
+		"example.com":              false,
+		"[::1]:8443":               false,
+	} {
+		if got := IsFile(target); got != want {
+			t.Errorf("%s: got %v, want %v", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package check
+
+import "time"
+
+// Service check types
+const (
+	TypeHttp = "http"
+	TypeTcp  = "tcp"
+	TypeIcmp = "icmp"
+)
+
+// Result of a service check run by the agent
+type Stats struct {
+	Name    string  `json:"n"`           // Check name
+	Type    string  `json:"t"`           // http, tcp or icmp
+	Up      float64 `json:"u"`           // 1 if up, 0 if down (fraction of time up in longer records)
+	Latency float64 `json:"l"`           // Response time in milliseconds
+	Status  int     `json:"s,omitempty"` // HTTP status code
+	Error   string  `json:"e,omitempty"` // Error message if the check failed
+}
+
+// TLS certificate details from an endpoint or PEM file
+type Certificate struct {
+	Name     string    `json:"n"`           // host:port or file path
+	Subject  string    `json:"s,omitempty"` // Leaf certificate subject common name
+	Issuer   string    `json:"i,omitempty"` // Leaf certificate issuer common name
+	NotAfter time.Time `json:"na"`          // Leaf certificate expiry
+	Valid    bool      `json:"v"`           // True if the chain verifies against the system roots
+	Error    string    `json:"e,omitempty"` // Connection, parse or verification error
+}
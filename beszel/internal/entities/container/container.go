@@ -49,11 +49,13 @@ type prevNetStats struct {
 
 // Docker konteyner istatistikleri
 type Stats struct {
-	Name        string       `json:"n"`  // İsim
-	Cpu         float64      `json:"c"`  // CPU kullanımı
-	Mem         float64      `json:"m"`  // Bellek kullanımı
-	NetworkSent float64      `json:"ns"` // Gönderilen ağ verisi
-	NetworkRecv float64      `json:"nr"` // Alınan ağ verisi
-	PrevCpu     [2]uint64    `json:"-"`  // Önceki CPU kullanımı
-	PrevNet     prevNetStats `json:"-"`  // Önceki ağ istatistikleri
+	Name        string       `json:"n"`            // İsim
+	Cpu         float64      `json:"c"`            // CPU kullanımı
+	Mem         float64      `json:"m"`            // Bellek kullanımı
+	NetworkSent float64      `json:"ns"`           // Gönderilen ağ verisi
+	NetworkRecv float64      `json:"nr"`           // Alınan ağ verisi
+	DiskRead    float64      `json:"dr,omitempty"` // Disk okuma (sadece LXC)
+	DiskWrite   float64      `json:"dw,omitempty"` // Disk yazma (sadece LXC)
+	PrevCpu     [2]uint64    `json:"-"`            // Önceki CPU kullanımı
+	PrevNet     prevNetStats `json:"-"`            // Önceki ağ istatistikleri
 }
@@ -0,0 +1,24 @@
+package system
+
+import "github.com/fxamacker/cbor/v2"
+
+// Encodings of agent responses. JSON is always supported. CBOR is smaller but
+// slower for the hub to decode, so the hub only requests it when configured to.
+const (
+	EncodingJSON = "json"
+	EncodingCBOR = "cbor"
+)
+
+// CBOR options shared by agent and hub. Field names come from the json tags,
+// floats are shortened when no precision is lost and times with a fraction of a
+// second are sent as float seconds, which keeps sub-microsecond precision.
+var CborEncMode = func() cbor.EncMode {
+	mode, err := cbor.EncOptions{
+		ShortestFloat: cbor.ShortestFloat16,
+		Time:          cbor.TimeUnixDynamic,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}()
@@ -1,15 +1,20 @@
 package system
 
 import (
+	"beszel/internal/entities/check"
 	"beszel/internal/entities/container"
+	"beszel/internal/entities/vm"
 	"time"
 )
 
 type Stats struct {
 	Cpu            float64             `json:"cpu"`
 	MaxCpu         float64             `json:"cpum,omitempty"`
+	MinCpu         float64             `json:"cpun"` // Low values are always sent, zero is a valid low
 	Mem            float64             `json:"m"`
 	MemUsed        float64             `json:"mu"`
+	MaxMemUsed     float64             `json:"mum,omitempty"`
+	MinMemUsed     float64             `json:"mun"`
 	MemPct         float64             `json:"mp"`
 	MemBuffCache   float64             `json:"mb"`
 	MemZfsArc      float64             `json:"mz,omitempty"` // ZFS ARC memory
@@ -22,13 +27,28 @@ type Stats struct {
 	DiskWritePs    float64             `json:"dw"`
 	MaxDiskReadPs  float64             `json:"drm,omitempty"`
 	MaxDiskWritePs float64             `json:"dwm,omitempty"`
+	MinDiskReadPs  float64             `json:"drn"`
+	MinDiskWritePs float64             `json:"dwn"`
 	NetworkSent    float64             `json:"ns"`
 	NetworkRecv    float64             `json:"nr"`
 	MaxNetworkSent float64             `json:"nsm,omitempty"`
 	MaxNetworkRecv float64             `json:"nrm,omitempty"`
+	MinNetworkSent float64             `json:"nsn"`
+	MinNetworkRecv float64             `json:"nrn"`
 	Temperatures   map[string]float64  `json:"t,omitempty"`
 	ExtraFs        map[string]*FsStats `json:"efs,omitempty"`
 	GPUData        map[string]GPUData  `json:"g,omitempty"`
+	Custom         map[string]float64  `json:"cu,omitempty"`
+	LogMatches     map[string]LogMatch `json:"lm,omitempty"`
+	FailedLogins   float64             `json:"fl,omitempty"` // Failed SSH logins since the previous poll
+	ClockOffset    float64             `json:"co,omitempty"` // Offset from NTP time reported by the agent (ms)
+	ClockDrift     float64             `json:"cd,omitempty"` // Difference between agent and hub clocks (ms)
+}
+
+// Lines matching a watched log pattern
+type LogMatch struct {
+	Count    float64 `json:"c"`           // Matching lines since the previous poll
+	LastLine string  `json:"l,omitempty"` // Last matching line
 }
 
 type GPUData struct {
@@ -75,11 +95,122 @@ type Info struct {
 	Bandwidth     float64 `json:"b"`
 	AgentVersion  string  `json:"v"`
 	Podman        bool    `json:"p,omitempty"`
+	// Pending package updates, nil until the agent's first check completes
+	Updates         *int `json:"up,omitempty"`
+	SecurityUpdates *int `json:"su,omitempty"`
+	RebootRequired  bool `json:"rr,omitempty"`
+	// Clock sync status: "synced", "unsynced" or empty if unknown
+	ClockSync string `json:"cs,omitempty"`
+	// Hardware and OS details, refreshed periodically
+	Inventory *Inventory `json:"inv,omitempty"`
+	// Agent settings in effect that can be managed by the hub
+	Config map[string]string `json:"cfg,omitempty"`
+}
+
+type Inventory struct {
+	Os             string          `json:"os,omitempty"` // Distribution, e.g. "ubuntu"
+	OsVersion      string          `json:"ov,omitempty"`
+	Arch           string          `json:"a,omitempty"`
+	Virtualization string          `json:"vt,omitempty"` // kvm, lxc, docker, etc. or "none" for bare metal
+	BootTime       uint64          `json:"bt,omitempty"` // Unix seconds
+	MemTotal       uint64          `json:"mt,omitempty"` // Bytes
+	Interfaces     []InterfaceInfo `json:"ni,omitempty"`
+	Disks          []DiskInfo      `json:"dk,omitempty"`
+	SysVendor      string          `json:"sv,omitempty"`
+	ProductName    string          `json:"pn,omitempty"`
+	BoardVendor    string          `json:"bv,omitempty"`
+	BoardName      string          `json:"bn,omitempty"`
+	BiosVendor     string          `json:"biv,omitempty"`
+	BiosVersion    string          `json:"bve,omitempty"`
+}
+
+type InterfaceInfo struct {
+	Name string   `json:"n"`
+	Mac  string   `json:"m,omitempty"`
+	Ips  []string `json:"ip,omitempty"` // Addresses in CIDR notation
+}
+
+type DiskInfo struct {
+	Name   string `json:"n"`
+	Model  string `json:"m,omitempty"`
+	Serial string `json:"s,omitempty"`
+	Size   uint64 `json:"sz,omitempty"` // Bytes
+}
+
+// Kernel or journal message at priority err or higher
+type Event struct {
+	Time     time.Time `json:"t"`
+	Source   string    `json:"s"`           // "kernel" or the systemd unit / syslog identifier
+	Priority uint8     `json:"p"`           // Syslog priority (0 emerg - 3 err)
+	Message  string    `json:"m"`           // Message text
+	Count    int       `json:"c,omitempty"` // Number of identical messages since the previous poll
+}
+
+// Listening TCP socket or bound UDP socket
+type ListeningPort struct {
+	Protocol string `json:"p"` // tcp, tcp6, udp or udp6
+	Address  string `json:"a"` // Bind address
+	Port     uint32 `json:"po"`
+	Process  string `json:"n,omitempty"` // Name of the owning process
+}
+
+// Interactive login session from utmp
+type Session struct {
+	User    string    `json:"u"`
+	Tty     string    `json:"t"`
+	Host    string    `json:"h,omitempty"` // Source address, empty for local logins
+	Started time.Time `json:"s"`
+}
+
+type WireGuardInterface struct {
+	Name       string          `json:"n"`
+	PublicKey  string          `json:"k"`
+	ListenPort int             `json:"p,omitempty"`
+	Peers      []WireGuardPeer `json:"pe,omitempty"`
+}
+
+type WireGuardPeer struct {
+	PublicKey    string  `json:"k"`
+	Endpoint     string  `json:"e,omitempty"`
+	AllowedIps   string  `json:"a,omitempty"` // Comma separated
+	HandshakeAge int64   `json:"h"`           // Seconds since the latest handshake, -1 if never
+	Rx           uint64  `json:"rx"`          // Total bytes received
+	Tx           uint64  `json:"tx"`          // Total bytes sent
+	RxRate       float64 `json:"rr"`          // MB/s
+	TxRate       float64 `json:"tr"`          // MB/s
 }
 
 // Final data structure to return to the hub
 type CombinedData struct {
-	Stats      Stats              `json:"stats"`
-	Info       Info               `json:"info"`
-	Containers []*container.Stats `json:"container"`
+	Stats        Stats                `json:"stats"`
+	Info         Info                 `json:"info"`
+	Containers   []*container.Stats   `json:"container"`
+	Checks       []*check.Stats       `json:"chk,omitempty"`
+	Certificates []check.Certificate  `json:"crt,omitempty"`
+	Events       []Event              `json:"ev,omitempty"`
+	Ports        []ListeningPort      `json:"lp"` // Empty if no ports are listening, nil if not reported
+	Sessions     []Session            `json:"ses,omitempty"`
+	VMs          []*vm.Stats          `json:"vm,omitempty"`
+	WireGuard    []WireGuardInterface `json:"wg,omitempty"`
+	Time         time.Time            `json:"ts"` // Agent clock when the data was gathered
+}
+
+// Version of the request protocol between hub and agent. Agents that predate
+// the protocol only send CombinedData and are treated as version 0.
+const ProtocolVersion = 1
+
+// Agent response to the "hello" request, listing the requests it supports
+type Hello struct {
+	Version      int      `json:"v"`
+	AgentVersion string   `json:"av"`
+	Capabilities []string `json:"caps"`
+	Encodings    []string `json:"enc,omitempty"` // Response encodings, most preferred first
+}
+
+// Stats gathered by the agent while the hub was unreachable, sent on request
+// so the hub can fill the gap
+type Sample struct {
+	Time       time.Time          `json:"t"`
+	Stats      Stats              `json:"s"`
+	Containers []*container.Stats `json:"c,omitempty"`
 }
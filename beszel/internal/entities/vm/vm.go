@@ -0,0 +1,14 @@
+package vm
+
+// Resource usage of a libvirt domain
+type Stats struct {
+	Name        string  `json:"n"`           // Domain name
+	Vcpus       int     `json:"v,omitempty"` // Number of virtual CPUs
+	Cpu         float64 `json:"c"`           // CPU usage as a percentage of the host
+	Mem         float64 `json:"m"`           // Host memory used by the domain in MB
+	DiskRead    float64 `json:"dr"`          // Disk read in MB/s
+	DiskWrite   float64 `json:"dw"`          // Disk write in MB/s
+	NetworkSent float64 `json:"ns"`          // Network sent in MB/s
+	NetworkRecv float64 `json:"nr"`          // Network received in MB/s
+	State       string  `json:"s,omitempty"` // running, paused, shutoff, etc.
+}
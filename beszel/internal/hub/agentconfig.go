@@ -0,0 +1,37 @@
+package hub
+
+import (
+	"github.com/goccy/go-json"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Returns the agent settings managed by the hub for a system as a JSON object
+func agentConfig(record *core.Record) string {
+	config := record.GetString("agent_config")
+	if config == "" || config == "null" {
+		return "{}"
+	}
+	return config
+}
+
+// Only admins can change the agent settings of a system. Settings must be a
+// JSON object of setting names (such as NICS or SENSORS) and values.
+func (h *Hub) validateAgentConfig(e *core.RecordRequestEvent) error {
+	config := agentConfig(e.Record)
+	original := "{}"
+	if !e.Record.IsNew() {
+		original = agentConfig(e.Record.Original())
+	}
+	if config == original {
+		return e.Next()
+	}
+	if !e.HasSuperuserAuth() && (e.Auth == nil || e.Auth.GetString("role") != "admin") {
+		return apis.NewForbiddenError("Only admins can change agent settings", nil)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(config), &settings); err != nil {
+		return apis.NewBadRequestError("Agent settings must be a JSON object", err)
+	}
+	return e.Next()
+}
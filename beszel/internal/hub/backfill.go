@@ -0,0 +1,76 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"golang.org/x/crypto/ssh"
+)
+
+// Time past the polling interval without an update after which stats the
+// agent buffered are requested
+const backfillThreshold = time.Minute
+
+// Requests the stats the agent buffered while the hub couldn't reach it and
+// saves them as 1m records with their original timestamps
+func (h *Hub) backfillStats(record *core.Record, client *ssh.Client, lastUpdate time.Time) {
+	protocol, err := h.getAgentProtocol(record, client)
+	if err != nil || !protocol.supports("backfill") {
+		return
+	}
+	systemStats, containerStats, err := h.getCollections()
+	if err != nil {
+		h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
+		return
+	}
+	// start after the last record saved, which can be older than the last update
+	// if the system was marked down
+	since := lastUpdate
+	if lastRecords, err := h.app.FindRecordsByFilter(systemStats, "system = {:system} && type = '1m'", "-created", 1, 0, map[string]any{"system": record.Id}); err == nil && len(lastRecords) > 0 {
+		since = lastRecords[0].GetDateTime("created").Time()
+	}
+
+	var samples []system.Sample
+	request := agentRequest{name: "backfill " + strconv.FormatInt(since.UnixMilli(), 10), config: agentConfig(record), encoding: protocol.encoding}
+	if err := h.requestFromAgent(client, request, &samples); err != nil {
+		h.app.Logger().Error("Failed to get buffered stats", "err", err.Error(), "system", record.GetString("name"))
+		return
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	// save in one transaction, a long outage can return hundreds of samples
+	h.app.RunInTransaction(func(txApp core.App) error {
+		for _, sample := range samples {
+			created, _ := types.ParseDateTime(sample.Time)
+			systemStatsRecord := core.NewRecord(systemStats)
+			systemStatsRecord.Set("system", record.Id)
+			systemStatsRecord.Set("stats", sample.Stats)
+			systemStatsRecord.Set("type", "1m")
+			systemStatsRecord.SetRaw("created", created)
+			systemStatsRecord.SetRaw("updated", created)
+			if err := txApp.SaveNoValidate(systemStatsRecord); err != nil {
+				h.app.Logger().Error("Failed to save record: ", "err", err.Error())
+			}
+			if len(sample.Containers) > 0 {
+				containerStatsRecord := core.NewRecord(containerStats)
+				containerStatsRecord.Set("system", record.Id)
+				containerStatsRecord.Set("stats", sample.Containers)
+				containerStatsRecord.Set("type", "1m")
+				containerStatsRecord.SetRaw("created", created)
+				containerStatsRecord.SetRaw("updated", created)
+				if err := txApp.SaveNoValidate(containerStatsRecord); err != nil {
+					h.app.Logger().Error("Failed to save record: ", "err", err.Error())
+				}
+			}
+		}
+		return nil
+	})
+	// 1m records are only kept for an hour, so average them into longer records
+	h.rm.CreateBackfillRecords(record.Id, []*core.Collection{systemStats, containerStats}, since, samples[len(samples)-1].Time)
+	h.app.Logger().Info("Backfilled stats", "system", record.GetString("name"), "records", len(samples), "from", samples[0].Time, "to", samples[len(samples)-1].Time)
+}
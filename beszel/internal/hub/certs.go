@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"beszel/internal/certs"
+	"beszel/internal/entities/check"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Saves certificate details reported by the agent and removes
+// records for certificates the agent no longer reports
+func (h *Hub) saveAgentCertificates(systemRecord *core.Record, certificates []check.Certificate) error {
+	collection, err := h.getCollection("certificates")
+	if err != nil {
+		return err
+	}
+	existing, err := h.app.FindAllRecords(collection,
+		dbx.HashExp{"system": systemRecord.Id, "source": "agent"},
+	)
+	if err != nil {
+		return err
+	}
+	existingMap := make(map[string]*core.Record, len(existing))
+	for _, record := range existing {
+		existingMap[record.GetString("name")] = record
+	}
+
+	for _, cert := range certificates {
+		record, ok := existingMap[cert.Name]
+		if ok {
+			delete(existingMap, cert.Name)
+		} else {
+			record = core.NewRecord(collection)
+			record.Set("system", systemRecord.Id)
+			record.Set("name", cert.Name)
+			record.Set("source", "agent")
+		}
+		if setCertificateFields(record, cert) {
+			if err := h.app.SaveNoValidate(record); err != nil {
+				h.app.Logger().Error("Failed to save certificate", "err", err.Error())
+			}
+		}
+	}
+
+	for _, record := range existingMap {
+		if err := h.app.Delete(record); err != nil {
+			h.app.Logger().Error("Failed to delete certificate", "err", err.Error())
+		}
+	}
+
+	return h.am.HandleCertificateAlerts(systemRecord)
+}
+
+// Checks certificates for endpoints configured in the hub (source = hub)
+func (h *Hub) checkHubCertificates() {
+	records, err := h.app.FindAllRecords("certificates", dbx.HashExp{"source": "hub"})
+	if err != nil || len(records) == 0 {
+		return
+	}
+	systemIds := make(map[string]struct{})
+	for _, record := range records {
+		h.checkHubCertificate(record)
+		systemIds[record.GetString("system")] = struct{}{}
+	}
+	for id := range systemIds {
+		if systemRecord, err := h.app.FindRecordById("systems", id); err == nil {
+			if err := h.am.HandleCertificateAlerts(systemRecord); err != nil {
+				h.app.Logger().Error("Certificate alerts error", "err", err.Error())
+			}
+		}
+	}
+}
+
+// Checks a single hub configured certificate and saves the result
+func (h *Hub) checkHubCertificate(record *core.Record) {
+	// local files are read on the agent, so the hub only checks endpoints
+	name := record.GetString("name")
+	if certs.IsFile(name) {
+		record.Set("error", "file certificates must be checked by the agent")
+		if err := h.app.SaveNoValidate(record); err != nil {
+			h.app.Logger().Error("Failed to save certificate", "err", err.Error())
+		}
+		return
+	}
+	cert := certs.InspectEndpoint(name, 5*time.Second)
+	setCertificateFields(record, cert)
+	if err := h.app.SaveNoValidate(record); err != nil {
+		h.app.Logger().Error("Failed to save certificate", "err", err.Error())
+	}
+}
+
+// Sets certificate fields on a record and returns true if anything changed
+func setCertificateFields(record *core.Record, cert check.Certificate) bool {
+	changed := record.IsNew() ||
+		record.GetString("subject") != cert.Subject ||
+		record.GetString("issuer") != cert.Issuer ||
+		!record.GetDateTime("expires").Time().Equal(cert.NotAfter) ||
+		record.GetBool("valid") != cert.Valid ||
+		record.GetString("error") != cert.Error
+	record.Set("subject", cert.Subject)
+	record.Set("issuer", cert.Issuer)
+	record.Set("expires", cert.NotAfter)
+	record.Set("valid", cert.Valid)
+	record.Set("error", cert.Error)
+	return changed
+}
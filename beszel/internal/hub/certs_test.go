@@ -0,0 +1,54 @@
+//go:build !goexperiment.jsonv2
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Hub checks make the hub connect to the endpoint, so only admins can add them
+func TestCertificateCreateRule(t *testing.T) {
+	h := newTestHub(t)
+	user, systemRecord := createTestSystem(t, h.app)
+	admin := createTestUser(t, h.app, "admin@example.com", "admin")
+	readonly := createTestUser(t, h.app, "readonly@example.com", "readonly")
+	otherAdmin := createTestUser(t, h.app, "other@example.com", "admin")
+	systemRecord.Set("users", []string{user.Id, admin.Id, readonly.Id})
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err := h.app.FindCollectionByNameOrId("certificates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := core.NewRecord(collection)
+	record.Set("system", systemRecord.Id)
+	record.Set("name", "example.com:443")
+	record.Set("source", "hub")
+	// rules are checked against saved records
+	if err := h.app.SaveNoValidate(record); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		auth *core.Record
+		want bool
+	}{
+		{name: "admin", auth: admin, want: true},
+		{name: "user", auth: user, want: false},
+		{name: "readonly", auth: readonly, want: false},
+		{name: "admin without access to the system", auth: otherAdmin, want: false},
+	} {
+		allowed, err := h.app.CanAccessRecord(record, &core.RequestInfo{Auth: tt.auth, Method: "POST"}, collection.CreateRule)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if allowed != tt.want {
+			t.Errorf("%s: allowed = %v, want %v", tt.name, allowed, tt.want)
+		}
+	}
+}
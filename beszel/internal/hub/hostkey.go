@@ -0,0 +1,108 @@
+package hub
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns the SSH client config for a system, which authenticates with the hub
+// keys and verifies the agent's host key
+func (h *Hub) clientConfig(record *core.Record) *ssh.ClientConfig {
+	config := *h.sshClientConfig
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(h.authSigners(record))}
+	config.HostKeyCallback = h.verifyHostKey(record)
+	return &config
+}
+
+// Pins the agent's host key in the system record on first connect (trust on first use)
+// and rejects connections presenting a different key until an admin trusts it.
+func (h *Hub) verifyHostKey(record *core.Record) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		offered := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n")
+		current, err := h.app.FindRecordById("systems", record.Id)
+		if err != nil {
+			return err
+		}
+		pinned := current.GetString("host_key")
+		if pinned == offered {
+			return nil
+		}
+		if pinned == "" {
+			current.Set("host_key", offered)
+			// skip hooks, which would start another connection to pending systems
+			if err := h.app.UnsafeWithoutHooks().SaveNoValidate(current); err != nil {
+				return err
+			}
+			// keep the record used by the caller in sync so later saves don't clear the key
+			record.Set("host_key", offered)
+			h.app.Logger().Info("Pinned host key", "system", record.GetString("name"), "fingerprint", ssh.FingerprintSHA256(key))
+			return nil
+		}
+		// save the offered key so an admin can trust it, also after a restart
+		if current.GetString("offered_host_key") != offered {
+			current.Set("offered_host_key", offered)
+			if err := h.app.UnsafeWithoutHooks().SaveNoValidate(current); err != nil {
+				return err
+			}
+			record.Set("offered_host_key", offered)
+		}
+		expected := pinned
+		if pinnedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned)); err == nil {
+			expected = ssh.FingerprintSHA256(pinnedKey)
+		}
+		return fmt.Errorf("host key mismatch: expected %s, got %s", expected, ssh.FingerprintSHA256(key))
+	}
+}
+
+// Trusts the changed host key last presented by a system's agent. Only admins
+// can re-trust a key, after checking the fingerprint with the agent's owner.
+func (h *Hub) trustHostKey(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	systemId := e.Request.URL.Query().Get("system")
+	record, err := h.app.FindRecordById("systems", systemId)
+	if err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+	offered := record.GetString("offered_host_key")
+	if offered == "" {
+		return apis.NewBadRequestError("No changed host key for system", nil)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(offered))
+	if err != nil {
+		return err
+	}
+	record.Set("host_key", offered)
+	record.Set("offered_host_key", "")
+	if err := h.app.SaveNoValidate(record); err != nil {
+		return err
+	}
+	h.app.Logger().Info("Trusted changed host key", "system", record.GetString("name"), "fingerprint", ssh.FingerprintSHA256(key), "user", info.Auth.Id)
+	return e.JSON(http.StatusOK, map[string]string{"key": offered, "fingerprint": ssh.FingerprintSHA256(key)})
+}
+
+// Only admins can set or change a system's pinned host key, because clearing it
+// lets the next connection pin any key, and a preset key skips trust on first use.
+// The same applies to the offered key, which admins trust as the next pinned key.
+func (h *Hub) validateHostKey(e *core.RecordRequestEvent) error {
+	var pinned, offered string
+	if !e.Record.IsNew() {
+		original := e.Record.Original()
+		pinned, offered = original.GetString("host_key"), original.GetString("offered_host_key")
+	}
+	if e.Record.GetString("host_key") == pinned && e.Record.GetString("offered_host_key") == offered {
+		return e.Next()
+	}
+	if !e.HasSuperuserAuth() && (e.Auth == nil || e.Auth.GetString("role") != "admin") {
+		return apis.NewForbiddenError("Only admins can change host keys", nil)
+	}
+	return e.Next()
+}
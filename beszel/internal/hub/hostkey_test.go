@@ -0,0 +1,170 @@
+//go:build !goexperiment.jsonv2
+
+package hub
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns a new host key and its authorized_keys line
+func newTestHostKey(t *testing.T) (ssh.PublicKey, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n")
+}
+
+// Creates a user with the role
+func createTestUser(t *testing.T, app core.App, email, role string) *core.Record {
+	t.Helper()
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.SetEmail(email)
+	user.SetPassword("testpassword")
+	user.Set("role", role)
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestVerifyHostKey(t *testing.T) {
+	h := newTestHub(t)
+	_, systemRecord := createTestSystem(t, h.app)
+	key1, line1 := newTestHostKey(t)
+	key2, line2 := newTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 45876}
+	verify := h.verifyHostKey(systemRecord)
+
+	// first connection pins the key
+	if err := verify("127.0.0.1:45876", addr, key1); err != nil {
+		t.Fatalf("first key rejected: %v", err)
+	}
+	stored, _ := h.app.FindRecordById("systems", systemRecord.Id)
+	if stored.GetString("host_key") != line1 || systemRecord.GetString("host_key") != line1 {
+		t.Fatalf("key not pinned: stored %q, record %q", stored.GetString("host_key"), systemRecord.GetString("host_key"))
+	}
+	if err := verify("127.0.0.1:45876", addr, key1); err != nil {
+		t.Errorf("pinned key rejected: %v", err)
+	}
+
+	// a different key is rejected and offered for an admin to trust
+	err := verify("127.0.0.1:45876", addr, key2)
+	if err == nil || !strings.Contains(err.Error(), ssh.FingerprintSHA256(key1)) || !strings.Contains(err.Error(), ssh.FingerprintSHA256(key2)) {
+		t.Fatalf("got %v, want a mismatch naming both fingerprints", err)
+	}
+	stored, _ = h.app.FindRecordById("systems", systemRecord.Id)
+	if stored.GetString("host_key") != line1 || stored.GetString("offered_host_key") != line2 {
+		t.Errorf("stored keys %q offered %q", stored.GetString("host_key"), stored.GetString("offered_host_key"))
+	}
+
+	// only admins can trust the offered key
+	trust := func(auth *core.Record) error {
+		req := httptest.NewRequest(http.MethodPost, "/api/beszel/trust-host-key?system="+systemRecord.Id, nil)
+		e := &core.RequestEvent{App: h.app, Auth: auth}
+		e.Response, e.Request = httptest.NewRecorder(), req
+		return h.trustHostKey(e)
+	}
+	var apiErr *router.ApiError
+	if err := trust(createTestUser(t, h.app, "user@example.com", "user")); !errors.As(err, &apiErr) || apiErr.Status != http.StatusForbidden {
+		t.Errorf("user trusted the key: %v", err)
+	}
+	if err := trust(createTestUser(t, h.app, "admin@example.com", "admin")); err != nil {
+		t.Fatal(err)
+	}
+	verify = h.verifyHostKey(systemRecord)
+	if err := verify("127.0.0.1:45876", addr, key2); err != nil {
+		t.Errorf("trusted key rejected: %v", err)
+	}
+	if err := verify("127.0.0.1:45876", addr, key1); err == nil {
+		t.Error("previous key accepted after trusting the new key")
+	}
+}
+
+func TestValidateHostKey(t *testing.T) {
+	h := newTestHub(t)
+	user, systemRecord := createTestSystem(t, h.app)
+	admin := createTestUser(t, h.app, "admin@example.com", "admin")
+	_, line1 := newTestHostKey(t)
+	_, line2 := newTestHostKey(t)
+	systemRecord.Set("host_key", line1)
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	systems := systemRecord.Collection()
+
+	tests := []struct {
+		name    string
+		auth    *core.Record
+		record  func() *core.Record
+		wantErr bool
+	}{
+		{name: "create without a key", auth: user, record: func() *core.Record { return core.NewRecord(systems) }},
+		{name: "create with a key", auth: user, wantErr: true, record: func() *core.Record {
+			record := core.NewRecord(systems)
+			record.Set("host_key", line1)
+			return record
+		}},
+		{name: "create with an offered key", auth: user, wantErr: true, record: func() *core.Record {
+			record := core.NewRecord(systems)
+			record.Set("offered_host_key", line1)
+			return record
+		}},
+		{name: "admin creates with a key", auth: admin, record: func() *core.Record {
+			record := core.NewRecord(systems)
+			record.Set("host_key", line1)
+			return record
+		}},
+		{name: "update other fields", auth: user, record: func() *core.Record {
+			record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+			record.Set("name", "renamed")
+			return record
+		}},
+		{name: "clear the key", auth: user, wantErr: true, record: func() *core.Record {
+			record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+			record.Set("host_key", "")
+			return record
+		}},
+		{name: "replace the key", auth: user, wantErr: true, record: func() *core.Record {
+			record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+			record.Set("host_key", line2)
+			return record
+		}},
+		{name: "set the offered key", auth: user, wantErr: true, record: func() *core.Record {
+			record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+			record.Set("offered_host_key", line2)
+			return record
+		}},
+		{name: "admin clears the key", auth: admin, record: func() *core.Record {
+			record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+			record.Set("host_key", "")
+			return record
+		}},
+	}
+	for _, tt := range tests {
+		e := &core.RecordRequestEvent{RequestEvent: &core.RequestEvent{App: h.app, Auth: tt.auth}, Record: tt.record()}
+		if err := h.validateHostKey(e); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
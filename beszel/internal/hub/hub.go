@@ -9,6 +9,7 @@ import (
 	"beszel/internal/users"
 	"beszel/site"
 
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"encoding/pem"
@@ -19,10 +20,12 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/goccy/go-json"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
@@ -34,13 +37,25 @@ import (
 type Hub struct {
 	app               *pocketbase.PocketBase
 	systemConnections sync.Map
+	outboundSystems   sync.Map     // ids of systems whose agents connect to the hub
+	tokenLimiter      tokenLimiter // failed agent token lookups by address
 	sshClientConfig   *ssh.ClientConfig
+	keyLock           sync.RWMutex // guards the hub keys during rotation
+	signer            ssh.Signer
 	pubKey            string
+	nextSigner        ssh.Signer // new key while a rotation is in progress
+	nextPubKey        string
+	rotatedSystems    sync.Map // ids of systems that accepted the new key
 	am                *alerts.AlertManager
 	um                *users.UserManager
 	rm                *records.RecordManager
 	systemStats       *core.Collection
 	containerStats    *core.Collection
+	collections       sync.Map // cached collections by name
+	agentProtocols    sync.Map // protocol negotiated with each system's agent
+	legacyAgents      sync.Map // time each system's agent was found to predate the protocol
+	updating          sync.Map // ids of systems with an update in progress
+	downRetries       sync.Map // time of the last connection attempt to each down system
 }
 
 func NewHub(app *pocketbase.PocketBase) *Hub {
@@ -129,17 +144,25 @@ func (h *Hub) Run() {
 
 	// set up scheduled jobs / ticker for system updates
 	h.app.OnServe().BindFunc(func(se *core.ServeEvent) error {
-		// 15 second ticker for system updates
+		// 5 second ticker for system updates
 		go h.startSystemUpdateTicker()
 		// set up cron jobs
 		// delete old records once every hour
 		h.app.Cron().MustAdd("delete old records", "8 * * * *", h.rm.DeleteOldRecords)
+		// average high resolution records into 1m records every minute
+		h.app.Cron().MustAdd("create minute records", "* * * * *", func() {
+			if collections, err := h.statsCollections(); err == nil {
+				h.rm.CreateMinuteRecords(collections)
+			}
+		})
 		// create longer records every 10 minutes
 		h.app.Cron().MustAdd("create longer records", "*/10 * * * *", func() {
-			if systemStats, containerStats, err := h.getCollections(); err == nil {
-				h.rm.CreateLongerRecords([]*core.Collection{systemStats, containerStats})
+			if collections, err := h.statsCollections(); err == nil {
+				h.rm.CreateLongerRecords(collections)
 			}
 		})
+		// check hub configured certificates every hour
+		h.app.Cron().MustAdd("check certificates", "15 * * * *", h.checkHubCertificates)
 		return se.Next()
 	})
 
@@ -151,7 +174,8 @@ func (h *Hub) Run() {
 			if info.Auth == nil {
 				return apis.NewForbiddenError("Forbidden", nil)
 			}
-			return e.JSON(http.StatusOK, map[string]string{"key": h.pubKey, "v": beszel.Version})
+			keys := h.publicKeys()
+			return e.JSON(http.StatusOK, map[string]any{"key": keys[0], "keys": keys, "v": beszel.Version})
 		})
 		// check if first time setup on login page
 		se.Router.GET("/api/beszel/first-run", func(e *core.RequestEvent) error {
@@ -162,6 +186,17 @@ func (h *Hub) Run() {
 		se.Router.GET("/api/beszel/send-test-notification", h.am.SendTestNotification)
 		// API endpoint to get config.yml content
 		se.Router.GET("/api/beszel/config-yaml", h.getYamlConfig)
+		// list systems with pending package updates
+		se.Router.GET("/api/beszel/outdated-systems", h.getOutdatedSystems)
+		// websocket endpoint for agents connecting to the hub
+		se.Router.GET("/api/beszel/agent-connect", h.handleAgentConnect)
+		// token agents use to connect to the hub
+		se.Router.GET("/api/beszel/agent-token", h.getAgentToken)
+		// trust a system's changed host key
+		se.Router.POST("/api/beszel/trust-host-key", h.trustHostKey)
+		// rotate the hub's SSH key
+		se.Router.GET("/api/beszel/key-rotation", h.getKeyRotation)
+		se.Router.POST("/api/beszel/key-rotation", h.rotateSSHKey)
 		// create first user endpoint only needed if no users exist
 		if totalUsers, _ := h.app.CountRecords("users"); totalUsers == 0 {
 			se.Router.POST("/api/beszel/create-user", h.um.CreateFirstUser)
@@ -176,12 +211,33 @@ func (h *Hub) Run() {
 		return e.Next()
 	})
 
+	// agent settings can only be changed by admins
+	h.app.OnRecordCreateRequest("systems").BindFunc(h.validateAgentConfig)
+	h.app.OnRecordUpdateRequest("systems").BindFunc(h.validateAgentConfig)
+	// pinned host keys can only be set or changed by admins
+	h.app.OnRecordCreateRequest("systems").BindFunc(h.validateHostKey)
+	h.app.OnRecordUpdateRequest("systems").BindFunc(h.validateHostKey)
+
 	// immediately create connection for new systems
 	h.app.OnRecordAfterCreateSuccess("systems").BindFunc(func(e *core.RecordEvent) error {
 		go h.updateSystem(e.Record)
 		return e.Next()
 	})
 
+	// certificates created in the hub are checked by the hub
+	h.app.OnRecordCreate("certificates").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("source") == "" {
+			e.Record.Set("source", "hub")
+		}
+		return e.Next()
+	})
+	h.app.OnRecordAfterCreateSuccess("certificates").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("source") == "hub" {
+			go h.checkHubCertificate(e.Record)
+		}
+		return e.Next()
+	})
+
 	// handle default values for user / user_settings creation
 	h.app.OnRecordCreate("users").BindFunc(h.um.InitializeUserRole)
 	h.app.OnRecordCreate("user_settings").BindFunc(h.um.InitializeUserSettings)
@@ -226,40 +282,68 @@ func (h *Hub) Run() {
 	}
 }
 
+// How often systems are checked for a due update
+const updateTickInterval = 5 * time.Second
+
+// Minimum time between connection attempts to a down system
+const downRetryInterval = 15 * time.Second
+
 func (h *Hub) startSystemUpdateTicker() {
-	c := time.Tick(15 * time.Second)
+	c := time.Tick(updateTickInterval)
 	for range c {
 		h.updateSystems()
 	}
 }
 
 func (h *Hub) updateSystems() {
-	records, err := h.app.FindRecordsByFilter(
+	systems, err := h.app.FindRecordsByFilter(
 		"2hz5ncl8tizk5nx",    // systems collection
 		"status != 'paused'", // filter
 		"updated",            // sort
 		-1,                   // limit
 		0,                    // offset
 	)
-	// log.Println("records", len(records))
-	if err != nil || len(records) == 0 {
+	// log.Println("systems", len(systems))
+	if err != nil || len(systems) == 0 {
 		// h.app.Logger().Error("Failed to query systems")
 		return
 	}
-	fiftySecondsAgo := time.Now().UTC().Add(-50 * time.Second)
-	batchSize := len(records)/4 + 1
+	// spread updates out by limiting each tick to the number of updates
+	// expected per tick, plus one
+	expectedUpdates := 0.0
+	for _, record := range systems {
+		expectedUpdates += float64(updateTickInterval) / float64(records.PollInterval(record))
+	}
+	batchSize := int(expectedUpdates) + 1
+	now := time.Now().UTC()
 	done := 0
-	for _, record := range records {
-		// break if batch size reached or if the system was updated less than 50 seconds ago
-		if done >= batchSize || record.GetDateTime("updated").Time().After(fiftySecondsAgo) {
+	for _, record := range systems {
+		if done >= batchSize {
 			break
 		}
+		// skip if the system was updated less than its interval ago, less one
+		// tick so updates don't slip to the following tick
+		if record.GetDateTime("updated").Time().After(now.Add(-records.PollInterval(record) + updateTickInterval)) {
+			continue
+		}
+		// skip if the previous update hasn't finished, which can happen with short intervals
+		if _, updating := h.updating.Load(record.Id); updating {
+			continue
+		}
 		// don't increment for down systems to avoid them jamming the queue
 		// because they're always first when sorted by least recently updated
 		if record.GetString("status") != "down" {
 			done++
+		} else if lastRetry, ok := h.downRetries.Load(record.Id); ok && now.Sub(lastRetry.(time.Time)) < downRetryInterval {
+			continue
+		} else {
+			h.downRetries.Store(record.Id, now)
 		}
-		go h.updateSystem(record)
+		h.updating.Store(record.Id, struct{}{})
+		go func() {
+			defer h.updating.Delete(record.Id)
+			h.updateSystem(record)
+		}()
 	}
 }
 
@@ -270,6 +354,10 @@ func (h *Hub) updateSystem(record *core.Record) {
 	// check if system connection exists
 	if existingClient, ok := h.systemConnections.Load(record.Id); ok {
 		client = existingClient.(*ssh.Client)
+	} else if _, ok := h.outboundSystems.Load(record.Id); ok {
+		// agent connects to the hub, so wait for it to reconnect
+		h.updateSystemStatus(record, "down")
+		return
 	} else {
 		// create system connection
 		client, err = h.createSystemConnection(record)
@@ -284,7 +372,7 @@ func (h *Hub) updateSystem(record *core.Record) {
 	}
 	// get system stats from agent
 	var systemData system.CombinedData
-	if err := h.requestJsonFromAgent(client, &systemData); err != nil {
+	if err := h.requestStats(record, client, &systemData); err != nil {
 		if err.Error() == "bad client" {
 			// if previous connection was closed, try again
 			h.app.Logger().Error("Existing SSH connection closed. Retrying...", "host", record.GetString("host"), "port", record.GetString("port"))
@@ -298,11 +386,29 @@ func (h *Hub) updateSystem(record *core.Record) {
 		return
 	}
 	// update system record
+	var oldInfo system.Info
+	_ = record.UnmarshalJSONField("info", &oldInfo)
+	lastUpdate := record.GetDateTime("updated").Time()
+	previousStatus := record.GetString("status")
 	record.Set("status", "up")
 	record.Set("info", systemData.Info)
+	record.Set("sessions", systemData.Sessions)
+	loginsSince := sessionsSince(record, systemData.Time)
+	record.Set("wireguard", systemData.WireGuard)
 	if err := h.app.SaveNoValidate(record); err != nil {
 		h.app.Logger().Error("Failed to update record: ", "err", err.Error())
 	}
+	// record inventory changes
+	if err := h.saveInventoryChanges(record, oldInfo.Inventory, systemData.Info.Inventory); err != nil {
+		h.app.Logger().Error("Failed to save inventory changes", "err", err.Error())
+	}
+	// save stats the agent buffered while the hub couldn't reach it
+	if previousStatus != "paused" && time.Since(lastUpdate) > records.PollInterval(record)+backfillThreshold {
+		h.backfillStats(record, client, lastUpdate)
+	}
+	// systems polled more than once a minute save high resolution records,
+	// which are averaged into 1m records by the record manager
+	recordType := records.PollRecordType(record)
 	// add system_stats and container_stats records
 	if systemStats, containerStats, err := h.getCollections(); err != nil {
 		h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
@@ -311,7 +417,7 @@ func (h *Hub) updateSystem(record *core.Record) {
 		systemStatsRecord := core.NewRecord(systemStats)
 		systemStatsRecord.Set("system", record.Id)
 		systemStatsRecord.Set("stats", systemData.Stats)
-		systemStatsRecord.Set("type", "1m")
+		systemStatsRecord.Set("type", recordType)
 		if err := h.app.SaveNoValidate(systemStatsRecord); err != nil {
 			h.app.Logger().Error("Failed to save record: ", "err", err.Error())
 		}
@@ -320,17 +426,94 @@ func (h *Hub) updateSystem(record *core.Record) {
 			containerStatsRecord := core.NewRecord(containerStats)
 			containerStatsRecord.Set("system", record.Id)
 			containerStatsRecord.Set("stats", systemData.Containers)
-			containerStatsRecord.Set("type", "1m")
+			containerStatsRecord.Set("type", recordType)
 			if err := h.app.SaveNoValidate(containerStatsRecord); err != nil {
 				h.app.Logger().Error("Failed to save record: ", "err", err.Error())
 			}
 		}
 	}
+	// add new vm_stats record
+	if len(systemData.VMs) > 0 {
+		if vmStats, err := h.getCollection("vm_stats"); err != nil {
+			h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
+		} else {
+			vmStatsRecord := core.NewRecord(vmStats)
+			vmStatsRecord.Set("system", record.Id)
+			vmStatsRecord.Set("stats", systemData.VMs)
+			vmStatsRecord.Set("type", recordType)
+			if err := h.app.SaveNoValidate(vmStatsRecord); err != nil {
+				h.app.Logger().Error("Failed to save record: ", "err", err.Error())
+			}
+		}
+	}
+	// add new check_stats record
+	if len(systemData.Checks) > 0 {
+		if checkStats, err := h.getCollection("check_stats"); err != nil {
+			h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
+		} else {
+			checkStatsRecord := core.NewRecord(checkStats)
+			checkStatsRecord.Set("system", record.Id)
+			checkStatsRecord.Set("stats", systemData.Checks)
+			checkStatsRecord.Set("type", recordType)
+			if err := h.app.SaveNoValidate(checkStatsRecord); err != nil {
+				h.app.Logger().Error("Failed to save record: ", "err", err.Error())
+			}
+		}
+	}
+
+	// save certificate details, also when none are reported to remove stale records
+	if err := h.saveAgentCertificates(record, systemData.Certificates); err != nil {
+		h.app.Logger().Error("Failed to save certificates", "err", err.Error())
+	}
+
+	// save kernel and journal error events
+	if len(systemData.Events) > 0 {
+		if systemEvents, err := h.getCollection("system_events"); err != nil {
+			h.app.Logger().Error("Failed to get collections: ", "err", err.Error())
+		} else {
+			for _, event := range systemData.Events {
+				eventRecord := core.NewRecord(systemEvents)
+				eventRecord.Set("system", record.Id)
+				eventRecord.Set("time", event.Time)
+				eventRecord.Set("source", event.Source)
+				eventRecord.Set("priority", event.Priority)
+				eventRecord.Set("message", event.Message)
+				eventRecord.Set("count", event.Count)
+				if err := h.app.SaveNoValidate(eventRecord); err != nil {
+					h.app.Logger().Error("Failed to save record: ", "err", err.Error())
+				}
+			}
+		}
+	}
+
+	// compare listening ports with the previous snapshot, including when all
+	// ports are closed (agents that don't report ports send nil)
+	if systemData.Ports != nil {
+		if err := h.saveListeningPorts(record, systemData.Ports); err != nil {
+			h.app.Logger().Error("Failed to save listening ports", "err", err.Error())
+		}
+	}
 
 	// system info alerts
-	if err := h.am.HandleSystemAlerts(record, systemData.Info, systemData.Stats.Temperatures, systemData.Stats.ExtraFs); err != nil {
+	if err := h.am.HandleSystemAlerts(record, systemData.Info, systemData.Stats); err != nil {
 		h.app.Logger().Error("System alerts error", "err", err.Error())
 	}
+	// service check alerts
+	if err := h.am.HandleCheckAlerts(record, systemData.Checks); err != nil {
+		h.app.Logger().Error("Check alerts error", "err", err.Error())
+	}
+	// login alerts
+	if err := h.am.HandleLoginAlerts(record, systemData.Sessions, loginsSince); err != nil {
+		h.app.Logger().Error("Login alerts error", "err", err.Error())
+	}
+	// vpn peer alerts
+	if err := h.am.HandleVpnAlerts(record, systemData.WireGuard); err != nil {
+		h.app.Logger().Error("VPN alerts error", "err", err.Error())
+	}
+	// package update alerts
+	if err := h.am.HandleUpdateAlerts(record, systemData.Info); err != nil {
+		h.app.Logger().Error("Update alerts error", "err", err.Error())
+	}
 }
 
 // return system_stats and container_stats collections
@@ -352,6 +535,34 @@ func (h *Hub) getCollections() (*core.Collection, *core.Collection, error) {
 	return h.systemStats, h.containerStats, nil
 }
 
+// return collection by name, caching the result
+func (h *Hub) getCollection(name string) (*core.Collection, error) {
+	if collection, ok := h.collections.Load(name); ok {
+		return collection.(*core.Collection), nil
+	}
+	collection, err := h.app.FindCollectionByNameOrId(name)
+	if err != nil {
+		return nil, err
+	}
+	h.collections.Store(name, collection)
+	return collection, nil
+}
+
+// return all collections with stats records that are averaged into longer records
+func (h *Hub) statsCollections() ([]*core.Collection, error) {
+	systemStats, containerStats, err := h.getCollections()
+	if err != nil {
+		return nil, err
+	}
+	collections := []*core.Collection{systemStats, containerStats}
+	for _, name := range []string{"check_stats", "vm_stats"} {
+		if collection, err := h.getCollection(name); err == nil {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
 // set system to specified status and save record
 func (h *Hub) updateSystemStatus(record *core.Record, status string) {
 	if record.Fresh().GetString("status") != status {
@@ -370,10 +581,11 @@ func (h *Hub) deleteSystemConnection(record *core.Record) {
 		}
 		h.systemConnections.Delete(record.Id)
 	}
+	h.agentProtocols.Delete(record.Id)
 }
 
 func (h *Hub) createSystemConnection(record *core.Record) (*ssh.Client, error) {
-	client, err := ssh.Dial("tcp", net.JoinHostPort(record.GetString("host"), record.GetString("port")), h.sshClientConfig)
+	client, err := ssh.Dial("tcp", net.JoinHostPort(record.GetString("host"), record.GetString("port")), h.clientConfig(record))
 	if err != nil {
 		return nil, err
 	}
@@ -381,7 +593,7 @@ func (h *Hub) createSystemConnection(record *core.Record) (*ssh.Client, error) {
 }
 
 func (h *Hub) createSSHClientConfig() error {
-	key, err := h.getSSHKey()
+	key, pubKey, err := h.getSSHKey(keyName)
 	if err != nil {
 		h.app.Logger().Error("Failed to get SSH key: ", "err", err.Error())
 		return err
@@ -392,38 +604,86 @@ func (h *Hub) createSSHClientConfig() error {
 	if err != nil {
 		return err
 	}
+	h.signer = signer
+	h.pubKey = pubKey
+
+	// resume a key rotation started before a restart
+	if _, err := os.Stat(h.app.DataDir() + "/" + nextKeyName); err == nil {
+		if err := h.loadNextKey(); err != nil {
+			return err
+		}
+	}
 
 	h.sshClientConfig = &ssh.ClientConfig{
 		User: "u",
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
+		// auth and host key verification are set per system by clientConfig
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Timeout:         4 * time.Second,
 	}
 	return nil
 }
 
-// Fetches system stats from the agent and decodes the json data into the provided struct
-func (h *Hub) requestJsonFromAgent(client *ssh.Client, systemData *system.CombinedData) error {
+// Sends a request to the agent and decodes the response into the provided value.
+// An empty request opens a shell, which agents that predate the protocol answer with stats.
+func (h *Hub) requestFromAgent(client *ssh.Client, request agentRequest, v any) error {
+	start := time.Now()
 	session, err := newSessionWithTimeout(client, 4*time.Second)
 	if err != nil {
 		return fmt.Errorf("bad client")
 	}
+	// opening a session takes one round trip to the agent
+	if request.timing != nil {
+		request.timing.rtt = time.Since(start)
+	}
 	defer session.Close()
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
 		return err
 	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
 
-	if err := session.Shell(); err != nil {
+	// send the agent settings managed by the hub (older agents ignore them)
+	if err := session.Setenv("BESZEL_CONFIG", request.config); err != nil {
+		h.app.Logger().Debug("Failed to send agent config", "err", err.Error())
+	}
+	if request.encoding != "" {
+		if err := session.Setenv("BESZEL_ENCODING", request.encoding); err != nil {
+			return err
+		}
+	}
+	// lets the agent tell missed polls apart from a long interval
+	if request.interval > 0 {
+		if err := session.Setenv("BESZEL_INTERVAL", strconv.Itoa(int(request.interval.Seconds()))); err != nil {
+			h.app.Logger().Debug("Failed to send polling interval", "err", err.Error())
+		}
+	}
+
+	if request.name == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(request.name)
+	}
+	if err != nil {
 		return err
 	}
 
-	if err := json.NewDecoder(stdout).Decode(systemData); err != nil {
+	if request.encoding == system.EncodingCBOR {
+		err = cbor.NewDecoder(stdout).Decode(v)
+	} else {
+		err = json.NewDecoder(stdout).Decode(v)
+	}
+	if err != nil {
+		// the agent explains rejected requests on stderr
+		if session.Wait() != nil && stderr.Len() > 0 {
+			return fmt.Errorf("%s: %s", request.name, strings.TrimSpace(stderr.String()))
+		}
 		return err
 	}
+	if request.timing != nil {
+		request.timing.received = time.Now()
+	}
 
 	// wait for the session to complete
 	if err := session.Wait(); err != nil {
@@ -459,72 +719,74 @@ func newSessionWithTimeout(client *ssh.Client, timeout time.Duration) (*ssh.Sess
 	}
 }
 
-func (h *Hub) getSSHKey() ([]byte, error) {
+// Returns the private and public key of the named key pair in the data directory,
+// generating the pair if it doesn't exist
+func (h *Hub) getSSHKey(name string) ([]byte, string, error) {
 	dataDir := h.app.DataDir()
 	// check if the key pair already exists
-	existingKey, err := os.ReadFile(dataDir + "/id_ed25519")
+	existingKey, err := os.ReadFile(dataDir + "/" + name)
 	if err == nil {
-		if pubKey, err := os.ReadFile(h.app.DataDir() + "/id_ed25519.pub"); err == nil {
-			h.pubKey = strings.TrimSuffix(string(pubKey), "\n")
+		var existingPubKey string
+		if pubKey, err := os.ReadFile(dataDir + "/" + name + ".pub"); err == nil {
+			existingPubKey = strings.TrimSuffix(string(pubKey), "\n")
 		}
 		// return existing private key
-		return existingKey, nil
+		return existingKey, existingPubKey, nil
 	}
 
 	// Generate the Ed25519 key pair
 	pubKey, privKey, err := ed25519.GenerateKey(nil)
 	if err != nil {
 		// h.app.Logger().Error("Error generating key pair:", "err", err.Error())
-		return nil, err
+		return nil, "", err
 	}
 
 	// Get the private key in OpenSSH format
 	privKeyBytes, err := ssh.MarshalPrivateKey(privKey, "")
 	if err != nil {
 		// h.app.Logger().Error("Error marshaling private key:", "err", err.Error())
-		return nil, err
+		return nil, "", err
 	}
 
 	// Save the private key to a file
-	privateFile, err := os.Create(dataDir + "/id_ed25519")
+	privateFile, err := os.Create(dataDir + "/" + name)
 	if err != nil {
 		// h.app.Logger().Error("Error creating private key file:", "err", err.Error())
-		return nil, err
+		return nil, "", err
 	}
 	defer privateFile.Close()
 
 	if err := pem.Encode(privateFile, privKeyBytes); err != nil {
 		// h.app.Logger().Error("Error writing private key to file:", "err", err.Error())
-		return nil, err
+		return nil, "", err
 	}
 
 	// Generate the public key in OpenSSH format
 	publicKey, err := ssh.NewPublicKey(pubKey)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	pubKeyBytes := ssh.MarshalAuthorizedKey(publicKey)
-	h.pubKey = strings.TrimSuffix(string(pubKeyBytes), "\n")
 
 	// Save the public key to a file
-	publicFile, err := os.Create(dataDir + "/id_ed25519.pub")
+	publicFile, err := os.Create(dataDir + "/" + name + ".pub")
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer publicFile.Close()
 
 	if _, err := publicFile.Write(pubKeyBytes); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	h.app.Logger().Info("ed25519 SSH key pair generated successfully.")
-	h.app.Logger().Info("Private key saved to: " + dataDir + "/id_ed25519")
-	h.app.Logger().Info("Public key saved to: " + dataDir + "/id_ed25519.pub")
+	h.app.Logger().Info("Private key saved to: " + dataDir + "/" + name)
+	h.app.Logger().Info("Public key saved to: " + dataDir + "/" + name + ".pub")
 
-	existingKey, err = os.ReadFile(dataDir + "/id_ed25519")
+	existingKey, err = os.ReadFile(dataDir + "/" + name)
 	if err == nil {
-		return existingKey, nil
+		return existingKey, strings.TrimSuffix(string(pubKeyBytes), "\n"), nil
 	}
-	return nil, err
+	return nil, "", err
 }
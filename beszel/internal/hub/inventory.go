@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"reflect"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Single changed inventory field
+type inventoryChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// Saves an inventory_changes record if the inventory reported by the agent
+// differs from the one stored in the system record. The first inventory
+// received for a system is saved as the baseline.
+func (h *Hub) saveInventoryChanges(systemRecord *core.Record, oldInventory, newInventory *system.Inventory) error {
+	if newInventory == nil {
+		return nil
+	}
+	changes := diffInventory(oldInventory, newInventory)
+	if len(changes) == 0 {
+		return nil
+	}
+	collection, err := h.getCollection("inventory_changes")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("system", systemRecord.Id)
+	record.Set("changes", changes)
+	record.Set("inventory", newInventory)
+	return h.app.SaveNoValidate(record)
+}
+
+// Returns the fields that differ between two inventories.
+// Boot time is ignored because it changes on every reboot.
+func diffInventory(oldInventory, newInventory *system.Inventory) []inventoryChange {
+	if oldInventory == nil {
+		oldInventory = &system.Inventory{}
+	}
+	// psutil doesn't list addresses in a stable order
+	sortInterfaceIps(oldInventory)
+	sortInterfaceIps(newInventory)
+	oldValue := reflect.ValueOf(*oldInventory)
+	newValue := reflect.ValueOf(*newInventory)
+	var changes []inventoryChange
+	for i := range newValue.NumField() {
+		field := newValue.Type().Field(i).Name
+		if field == "BootTime" {
+			continue
+		}
+		o, n := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, inventoryChange{Field: field, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// Sorts the addresses of each interface in place
+func sortInterfaceIps(inventory *system.Inventory) {
+	for _, iface := range inventory.Interfaces {
+		slices.Sort(iface.Ips)
+	}
+}
@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"slices"
+	"testing"
+)
+
+func TestDiffInventory(t *testing.T) {
+	base := func() *system.Inventory {
+		return &system.Inventory{
+			Os:       "ubuntu",
+			BootTime: 1700000000,
+			MemTotal: 8 << 30,
+			Interfaces: []system.InterfaceInfo{
+				{Name: "eth0", Mac: "00:11:22:33:44:55", Ips: []string{"192.168.1.10/24", "2001:db8::10/64"}},
+				{Name: "eth1", Ips: []string{"10.0.0.5/8"}},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		old    *system.Inventory
+		update func(*system.Inventory)
+		want   []string // changed fields
+	}{
+		{name: "unchanged", old: base(), update: func(*system.Inventory) {}},
+		{name: "baseline", update: func(*system.Inventory) {}, want: []string{"Os", "MemTotal", "Interfaces"}},
+		{name: "reboot", old: base(), update: func(i *system.Inventory) { i.BootTime += 3600 }},
+		{name: "addresses reordered", old: base(), update: func(i *system.Inventory) {
+			i.Interfaces[0].Ips = []string{"2001:db8::10/64", "192.168.1.10/24"}
+		}},
+		{name: "address added", old: base(), update: func(i *system.Inventory) {
+			i.Interfaces[1].Ips = []string{"10.0.0.6/8", "10.0.0.5/8"}
+		}, want: []string{"Interfaces"}},
+		{name: "address changed", old: base(), update: func(i *system.Inventory) {
+			i.Interfaces[0].Ips = []string{"2001:db8::10/64", "192.168.1.11/24"}
+		}, want: []string{"Interfaces"}},
+		{name: "memory and os upgraded", old: base(), update: func(i *system.Inventory) {
+			i.MemTotal = 16 << 30
+			i.OsVersion = "24.04"
+		}, want: []string{"OsVersion", "MemTotal"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newInventory := base()
+			tt.update(newInventory)
+			var got []string
+			for _, change := range diffInventory(tt.old, newInventory) {
+				got = append(got, change.Field)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changed fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
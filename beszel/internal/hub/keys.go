@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Key pair used to connect to agents
+	keyName = "id_ed25519"
+	// Key pair generated by a key rotation, replacing the current pair once all agents accept it
+	nextKeyName = "id_ed25519_next"
+)
+
+// System that hasn't accepted the new key yet
+type pendingSystem struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Signer for the new key that records which systems accept it. The client
+// only signs after the agent accepts the key, so a signature means the
+// agent has the new key.
+type rotationSigner struct {
+	ssh.Signer
+	onSign func()
+}
+
+func (s rotationSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.onSign()
+	return s.Signer.Sign(rand, data)
+}
+
+// Returns the public keys agents should accept, newest first
+func (h *Hub) publicKeys() []string {
+	h.keyLock.RLock()
+	defer h.keyLock.RUnlock()
+	if h.nextSigner != nil {
+		return []string{h.nextPubKey, h.pubKey}
+	}
+	return []string{h.pubKey}
+}
+
+// Returns the signers used to authenticate with a system's agent. During a
+// rotation the new key is tried first, falling back to the current key.
+func (h *Hub) authSigners(record *core.Record) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		h.keyLock.RLock()
+		defer h.keyLock.RUnlock()
+		if h.nextSigner == nil {
+			return []ssh.Signer{h.signer}, nil
+		}
+		next := rotationSigner{Signer: h.nextSigner, onSign: func() {
+			if _, loaded := h.rotatedSystems.LoadOrStore(record.Id, struct{}{}); !loaded {
+				go h.finishKeyRotation()
+			}
+		}}
+		return []ssh.Signer{next, h.signer}, nil
+	}
+}
+
+// Loads the new key pair of a key rotation, generating it if it doesn't exist
+func (h *Hub) loadNextKey() error {
+	key, pubKey, err := h.getSSHKey(nextKeyName)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	h.keyLock.Lock()
+	h.nextSigner = signer
+	h.nextPubKey = pubKey
+	h.keyLock.Unlock()
+	return nil
+}
+
+// Returns the systems that haven't accepted the new key. Paused systems are skipped.
+func (h *Hub) pendingRotationSystems() ([]pendingSystem, error) {
+	records, err := h.app.FindRecordsByFilter("systems", "status != 'paused'", "name", -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	pending := []pendingSystem{}
+	for _, record := range records {
+		if _, ok := h.rotatedSystems.Load(record.Id); !ok {
+			pending = append(pending, pendingSystem{Id: record.Id, Name: record.GetString("name")})
+		}
+	}
+	return pending, nil
+}
+
+// Replaces the current key with the new key once all systems accept it
+func (h *Hub) finishKeyRotation() {
+	pending, err := h.pendingRotationSystems()
+	if err != nil || len(pending) > 0 {
+		return
+	}
+	h.keyLock.Lock()
+	defer h.keyLock.Unlock()
+	if h.nextSigner == nil {
+		return
+	}
+	dataDir := h.app.DataDir()
+	if err := os.Rename(dataDir+"/"+nextKeyName+".pub", dataDir+"/"+keyName+".pub"); err != nil {
+		h.app.Logger().Error("Failed to replace SSH key: ", "err", err.Error())
+		return
+	}
+	if err := os.Rename(dataDir+"/"+nextKeyName, dataDir+"/"+keyName); err != nil {
+		h.app.Logger().Error("Failed to replace SSH key: ", "err", err.Error())
+		return
+	}
+	h.signer = h.nextSigner
+	h.pubKey = h.nextPubKey
+	h.nextSigner = nil
+	h.nextPubKey = ""
+	h.rotatedSystems.Clear()
+	h.app.Logger().Info("SSH key rotation finished, old key retired")
+}
+
+// Returns the new key and the systems that don't accept it yet
+func (h *Hub) getKeyRotation(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	keys := h.publicKeys()
+	if len(keys) == 1 {
+		return e.JSON(http.StatusOK, map[string]any{"active": false})
+	}
+	pending, err := h.pendingRotationSystems()
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]any{"active": true, "key": keys[0], "pending": pending})
+}
+
+// Starts a key rotation. A new key pair is generated and served by getkey
+// alongside the current key. The hub authenticates with either key, and the
+// current key is retired once every system has accepted the new one.
+func (h *Hub) rotateSSHKey(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil || info.Auth.GetString("role") != "admin" {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	if len(h.publicKeys()) > 1 {
+		return apis.NewBadRequestError("Key rotation already in progress", nil)
+	}
+	if err := h.loadNextKey(); err != nil {
+		return err
+	}
+	h.app.Logger().Info("SSH key rotation started", "user", info.Auth.Id)
+	// reconnect so each agent is checked for the new key
+	h.systemConnections.Range(func(id, client any) bool {
+		client.(*ssh.Client).Close()
+		h.systemConnections.Delete(id)
+		return true
+	})
+	// nothing to wait for if there are no systems
+	go h.finishKeyRotation()
+	return e.JSON(http.StatusOK, map[string]string{"key": h.publicKeys()[0]})
+}
@@ -0,0 +1,159 @@
+package hub
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/websocket"
+)
+
+// Accepts a WebSocket connection from an agent that connects to the hub
+// instead of listening for connections. The agent identifies the system with
+// its token, then the hub opens an SSH client over the connection and polls
+// it like any other system.
+func (h *Hub) handleAgentConnect(e *core.RequestEvent) error {
+	addr := e.RealIP()
+	if wait := h.tokenLimiter.wait(addr); wait > 0 {
+		e.Response.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return apis.NewTooManyRequestsError("Too many invalid tokens", nil)
+	}
+	token := e.Request.Header.Get("X-Token")
+	if token == "" {
+		h.tokenLimiter.failed(addr)
+		return apis.NewUnauthorizedError("Missing token", nil)
+	}
+	record, err := h.app.FindFirstRecordByData("systems", "token", token)
+	if err != nil {
+		h.tokenLimiter.failed(addr)
+		return apis.NewUnauthorizedError("Invalid token", nil)
+	}
+	h.tokenLimiter.succeeded(addr)
+	if record.GetString("status") == "paused" {
+		return apis.NewForbiddenError("System is paused", nil)
+	}
+	websocket.Server{
+		// agents don't send an origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			h.serveAgentConnection(record, conn)
+		},
+	}.ServeHTTP(e.Response, e.Request)
+	return nil
+}
+
+// Returns the token an agent uses to connect to the hub as a system. The token
+// field is hidden, so only admins and users who can edit the system can read it.
+func (h *Hub) getAgentToken(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	record, err := h.app.FindRecordById("systems", e.Request.URL.Query().Get("system"))
+	if err != nil {
+		return apis.NewNotFoundError("System not found", nil)
+	}
+	role := info.Auth.GetString("role")
+	if role != "admin" && (role == "readonly" || !slices.Contains(record.GetStringSlice("users"), info.Auth.Id)) {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	return e.JSON(http.StatusOK, map[string]string{"token": record.GetString("token")})
+}
+
+// Runs an SSH client over the agent's connection until it closes
+func (h *Hub) serveAgentConnection(record *core.Record, conn *websocket.Conn) {
+	conn.PayloadType = websocket.BinaryFrame
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, conn.Request().RemoteAddr, h.clientConfig(record))
+	if err != nil {
+		h.app.Logger().Error("Failed to connect:", "err", err.Error(), "system", record.GetString("name"))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	// replace any previous connection to the system
+	h.deleteSystemConnection(record)
+	h.systemConnections.Store(record.Id, client)
+	h.outboundSystems.Store(record.Id, struct{}{})
+	h.app.Logger().Info("Agent connected", "system", record.GetString("name"), "addr", conn.Request().RemoteAddr)
+
+	go h.updateSystem(record)
+	client.Wait()
+
+	// the connection may already have been replaced by a newer one. Otherwise
+	// the system is polled like an inbound system until the agent reconnects,
+	// so switching back to inbound or revoking the token takes effect.
+	if h.systemConnections.CompareAndDelete(record.Id, client) {
+		h.outboundSystems.Delete(record.Id)
+	}
+	h.app.Logger().Info("Agent disconnected", "system", record.GetString("name"))
+}
+
+// Failed token lookups allowed from an address before it has to wait between
+// attempts, and the longest wait. Agents retry with their own backoff, so
+// only guessing tokens reaches the limit.
+const (
+	maxTokenFailures = 5
+	maxTokenBackoff  = 15 * time.Minute
+)
+
+// Tracks failed agent token lookups by address to slow down token guessing
+type tokenLimiter struct {
+	sync.Mutex
+	failures map[string]*tokenFailures
+}
+
+type tokenFailures struct {
+	count int
+	last  time.Time
+}
+
+// Returns how long the address has to wait before trying another token
+func (l *tokenLimiter) wait(addr string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	f, ok := l.failures[addr]
+	if !ok || f.count < maxTokenFailures {
+		return 0
+	}
+	// doubles with each failure over the limit
+	backoff := maxTokenBackoff
+	if shift := f.count - maxTokenFailures; shift < 10 {
+		backoff = min(time.Second<<shift, maxTokenBackoff)
+	}
+	return max(0, time.Until(f.last.Add(backoff)))
+}
+
+func (l *tokenLimiter) failed(addr string) {
+	l.Lock()
+	defer l.Unlock()
+	if l.failures == nil {
+		l.failures = make(map[string]*tokenFailures)
+	}
+	now := time.Now()
+	// forget addresses that stopped trying
+	for a, f := range l.failures {
+		if now.Sub(f.last) > maxTokenBackoff {
+			delete(l.failures, a)
+		}
+	}
+	f, ok := l.failures[addr]
+	if !ok {
+		f = &tokenFailures{}
+		l.failures[addr] = f
+	}
+	f.count++
+	f.last = now
+}
+
+func (l *tokenLimiter) succeeded(addr string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.failures, addr)
+}
@@ -0,0 +1,208 @@
+//go:build !goexperiment.jsonv2
+
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sshServer "github.com/gliderlabs/ssh"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/net/websocket"
+)
+
+// Serves the hub's agent endpoint
+func newAgentConnectServer(t *testing.T, h *Hub) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &core.RequestEvent{App: h.app}
+		e.Response, e.Request = w, r
+		if err := h.handleAgentConnect(e); err != nil {
+			var apiErr *router.ApiError
+			if errors.As(err, &apiErr) {
+				http.Error(w, apiErr.Message, apiErr.Status)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Returns an SSH server that authorizes the hub's key and answers hello and
+// stats requests like an agent
+func newTestAgentServer(t *testing.T, h *Hub) *sshServer.Server {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hubKey := h.signer.PublicKey().Marshal()
+	server := &sshServer.Server{
+		ChannelHandlers: sshServer.DefaultChannelHandlers,
+		Handler: func(s sshServer.Session) {
+			var response any = system.CombinedData{Info: system.Info{Hostname: "agent"}}
+			if s.RawCommand() == "hello" {
+				response = system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}}
+			}
+			json.NewEncoder(s).Encode(response)
+			s.Exit(0)
+		},
+	}
+	server.AddHostKey(hostKey)
+	server.SetOption(sshServer.PublicKeyAuth(func(ctx sshServer.Context, key sshServer.PublicKey) bool {
+		return string(key.Marshal()) == string(hubKey)
+	}))
+	return server
+}
+
+// Connects to the hub with the token like an outbound agent
+func dialHub(server *httptest.Server, token string) (*websocket.Conn, error) {
+	location := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/beszel/agent-connect"
+	config, err := websocket.NewConfig(location, location)
+	if err != nil {
+		return nil, err
+	}
+	config.Header = http.Header{"X-Token": []string{token}}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	conn.PayloadType = websocket.BinaryFrame
+	return conn, nil
+}
+
+// Waits until the condition is true or fails the test
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentConnect(t *testing.T) {
+	h := newTestHub(t)
+	if err := h.createSSHClientConfig(); err != nil {
+		t.Fatal(err)
+	}
+	_, systemRecord := createTestSystem(t, h.app)
+	systemRecord.Set("token", "valid-token")
+	systemRecord.Set("status", "pending")
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	server := newAgentConnectServer(t, h)
+
+	// wrong token
+	if _, err := dialHub(server, "wrong-token"); err == nil {
+		t.Fatal("connected with a wrong token")
+	}
+	if _, ok := h.outboundSystems.Load(systemRecord.Id); ok {
+		t.Fatal("system is outbound after a wrong token")
+	}
+
+	// valid token
+	conn, err := dialHub(server, "valid-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		newTestAgentServer(t, h).HandleConn(conn)
+		close(done)
+	}()
+	waitFor(t, "the system to be up", func() bool {
+		record, err := h.app.FindRecordById("systems", systemRecord.Id)
+		return err == nil && record.GetString("status") == "up"
+	})
+	if _, ok := h.outboundSystems.Load(systemRecord.Id); !ok {
+		t.Error("system isn't outbound after connecting")
+	}
+	record, _ := h.app.FindRecordById("systems", systemRecord.Id)
+	if record.GetString("host_key") == "" {
+		t.Error("agent host key wasn't pinned")
+	}
+
+	// disconnect
+	conn.Close()
+	<-done
+	waitFor(t, "the connection to close", func() bool {
+		_, connected := h.systemConnections.Load(systemRecord.Id)
+		_, outbound := h.outboundSystems.Load(systemRecord.Id)
+		return !connected && !outbound
+	})
+}
+
+func TestAgentConnectTokenLimit(t *testing.T) {
+	h := newTestHub(t)
+	_, systemRecord := createTestSystem(t, h.app)
+	systemRecord.Set("token", "valid-token")
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	server := newAgentConnectServer(t, h)
+
+	request := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("X-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for i := range maxTokenFailures {
+		if status := request("wrong-token"); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+	// the valid token has to wait too, so guessing can't be confirmed
+	if status := request("valid-token"); status != http.StatusTooManyRequests {
+		t.Errorf("status %d after %d failures, want %d", status, maxTokenFailures, http.StatusTooManyRequests)
+	}
+}
+
+func TestTokenLimiterBackoff(t *testing.T) {
+	var l tokenLimiter
+	for range maxTokenFailures - 1 {
+		l.failed("10.0.0.1")
+	}
+	if wait := l.wait("10.0.0.1"); wait != 0 {
+		t.Errorf("wait %v before the limit", wait)
+	}
+	l.failed("10.0.0.1")
+	if wait := l.wait("10.0.0.1"); wait <= 0 || wait > time.Second {
+		t.Errorf("wait %v at the limit, want up to 1s", wait)
+	}
+	for range 20 {
+		l.failed("10.0.0.1")
+	}
+	if wait := l.wait("10.0.0.1"); wait <= 10*time.Minute || wait > maxTokenBackoff {
+		t.Errorf("wait %v after many failures, want up to %v", wait, maxTokenBackoff)
+	}
+	if wait := l.wait("10.0.0.2"); wait != 0 {
+		t.Errorf("other address waits %v", wait)
+	}
+	l.succeeded("10.0.0.1")
+	if wait := l.wait("10.0.0.1"); wait != 0 {
+		t.Errorf("wait %v after a valid token", wait)
+	}
+}
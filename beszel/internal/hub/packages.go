@@ -0,0 +1,60 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"cmp"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Out-of-date system returned by the outdated-systems endpoint
+type outdatedSystem struct {
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Host            string `json:"host"`
+	Updates         int    `json:"updates"`
+	SecurityUpdates int    `json:"security_updates"`
+	RebootRequired  bool   `json:"reboot_required"`
+}
+
+// Returns the user's systems with pending package updates or a required reboot,
+// sorted by the number of security updates
+func (h *Hub) getOutdatedSystems(e *core.RequestEvent) error {
+	info, _ := e.RequestInfo()
+	if info.Auth == nil {
+		return apis.NewForbiddenError("Forbidden", nil)
+	}
+	records, err := h.app.FindRecordsByFilter("systems", "users.id ?= {:user}", "name", -1, 0, map[string]any{"user": info.Auth.Id})
+	if err != nil {
+		return err
+	}
+	outdated := []outdatedSystem{}
+	for _, record := range records {
+		var systemInfo system.Info
+		if err := record.UnmarshalJSONField("info", &systemInfo); err != nil {
+			continue
+		}
+		var updates, securityUpdates int
+		if systemInfo.Updates != nil && systemInfo.SecurityUpdates != nil {
+			updates, securityUpdates = *systemInfo.Updates, *systemInfo.SecurityUpdates
+		}
+		if updates == 0 && securityUpdates == 0 && !systemInfo.RebootRequired {
+			continue
+		}
+		outdated = append(outdated, outdatedSystem{
+			Id:              record.Id,
+			Name:            record.GetString("name"),
+			Host:            record.GetString("host"),
+			Updates:         updates,
+			SecurityUpdates: securityUpdates,
+			RebootRequired:  systemInfo.RebootRequired,
+		})
+	}
+	slices.SortStableFunc(outdated, func(a, b outdatedSystem) int {
+		return cmp.Compare(b.SecurityUpdates, a.SecurityUpdates)
+	})
+	return e.JSON(http.StatusOK, outdated)
+}
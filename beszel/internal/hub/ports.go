@@ -0,0 +1,81 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"fmt"
+	"net"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Compares the listening ports reported by the agent with the previous snapshot,
+// saves the snapshot and the differences, and alerts on new externally bound ports.
+// The first snapshot of a system is saved as the baseline without alerting.
+func (h *Hub) saveListeningPorts(systemRecord *core.Record, ports []system.ListeningPort) error {
+	collection, err := h.getCollection("listening_ports")
+	if err != nil {
+		return err
+	}
+	record, err := h.app.FindFirstRecordByFilter(collection, "system = {:system}", dbx.Params{"system": systemRecord.Id})
+	baseline := err != nil
+	if baseline {
+		record = core.NewRecord(collection)
+		record.Set("system", systemRecord.Id)
+	}
+
+	var previous []system.ListeningPort
+	_ = record.UnmarshalJSONField("ports", &previous)
+	added := diffPorts(ports, previous)
+	removed := diffPorts(previous, ports)
+	if !baseline && len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	record.Set("ports", ports)
+	record.Set("added", added)
+	record.Set("removed", removed)
+	if err := h.app.SaveNoValidate(record); err != nil {
+		return err
+	}
+	if baseline {
+		return nil
+	}
+
+	var exposed []system.ListeningPort
+	for _, port := range added {
+		if !isLoopback(port.Address) {
+			exposed = append(exposed, port)
+		}
+	}
+	if len(exposed) > 0 {
+		return h.am.HandlePortAlerts(systemRecord, exposed)
+	}
+	return nil
+}
+
+// Returns ports in a that are not in b. The process name is ignored
+// so restarted services aren't reported as changes.
+func diffPorts(a, b []system.ListeningPort) []system.ListeningPort {
+	existing := make(map[string]struct{}, len(b))
+	for _, port := range b {
+		existing[portKey(port)] = struct{}{}
+	}
+	diff := []system.ListeningPort{}
+	for _, port := range a {
+		if _, ok := existing[portKey(port)]; !ok {
+			diff = append(diff, port)
+		}
+	}
+	return diff
+}
+
+func portKey(port system.ListeningPort) string {
+	return fmt.Sprintf("%s %s %d", port.Protocol, port.Address, port.Port)
+}
+
+// Returns true if the bind address is only reachable from the host
+func isLoopback(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,114 @@
+//go:build !goexperiment.jsonv2
+
+// PocketBase collections don't decode with encoding/json v2, so these tests
+// only build with the json package of Go 1.23 or GOEXPERIMENT=nojsonv2.
+
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	_ "beszel/migrations"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Creates a hub with a migrated database in a temporary directory
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.ResetBootstrapState() })
+	return NewHub(app)
+}
+
+// Creates a user and a system the user can see
+func createTestSystem(t *testing.T, app core.App) (user, systemRecord *core.Record) {
+	t.Helper()
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user = core.NewRecord(users)
+	user.SetEmail("test@example.com")
+	user.SetPassword("testpassword")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	systems, err := app.FindCollectionByNameOrId("systems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemRecord = core.NewRecord(systems)
+	systemRecord.Set("name", "test")
+	systemRecord.Set("host", "127.0.0.1")
+	systemRecord.Set("port", "45876")
+	systemRecord.Set("status", "up")
+	systemRecord.Set("users", user.Id)
+	if err := app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	return user, systemRecord
+}
+
+func TestSaveListeningPorts(t *testing.T) {
+	ssh := system.ListeningPort{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Process: "sshd"}
+	web := system.ListeningPort{Protocol: "tcp", Address: "0.0.0.0", Port: 80, Process: "nginx"}
+	dns := system.ListeningPort{Protocol: "udp", Address: "127.0.0.53", Port: 53}
+
+	h := newTestHub(t)
+	_, systemRecord := createTestSystem(t, h.app)
+
+	// each poll reports a snapshot, and the saved differences are compared
+	// with the previous snapshot
+	polls := []struct {
+		name        string
+		ports       []system.ListeningPort
+		wantAdded   []uint32
+		wantRemoved []uint32
+	}{
+		{name: "baseline", ports: []system.ListeningPort{ssh, dns}, wantAdded: []uint32{22, 53}, wantRemoved: []uint32{}},
+		{name: "port opened", ports: []system.ListeningPort{ssh, web, dns}, wantAdded: []uint32{80}, wantRemoved: []uint32{}},
+		{name: "process renamed", ports: []system.ListeningPort{{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Process: "sshd-session"}, web, dns}, wantAdded: []uint32{80}, wantRemoved: []uint32{}},
+		{name: "all ports closed", ports: []system.ListeningPort{}, wantAdded: []uint32{}, wantRemoved: []uint32{22, 80, 53}},
+		{name: "port reopened", ports: []system.ListeningPort{ssh}, wantAdded: []uint32{22}, wantRemoved: []uint32{}},
+	}
+	for _, poll := range polls {
+		if err := h.saveListeningPorts(systemRecord, poll.ports); err != nil {
+			t.Fatalf("%s: %v", poll.name, err)
+		}
+		record, err := h.app.FindFirstRecordByFilter("listening_ports", "system = {:system}", dbx.Params{"system": systemRecord.Id})
+		if err != nil {
+			t.Fatalf("%s: %v", poll.name, err)
+		}
+		var ports, added, removed []system.ListeningPort
+		_ = record.UnmarshalJSONField("ports", &ports)
+		_ = record.UnmarshalJSONField("added", &added)
+		_ = record.UnmarshalJSONField("removed", &removed)
+		if len(ports) != len(poll.ports) {
+			t.Errorf("%s: saved %d ports, want %d", poll.name, len(ports), len(poll.ports))
+		}
+		if got := portNumbers(added); !slices.Equal(got, poll.wantAdded) {
+			t.Errorf("%s: added %v, want %v", poll.name, got, poll.wantAdded)
+		}
+		if got := portNumbers(removed); !slices.Equal(got, poll.wantRemoved) {
+			t.Errorf("%s: removed %v, want %v", poll.name, got, poll.wantRemoved)
+		}
+	}
+}
+
+func portNumbers(ports []system.ListeningPort) []uint32 {
+	numbers := make([]uint32, 0, len(ports))
+	for _, port := range ports {
+		numbers = append(numbers, port.Port)
+	}
+	return numbers
+}
@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"beszel/internal/records"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+// Protocol negotiated with a system's agent over a connection
+type agentProtocol struct {
+	client   *ssh.Client
+	hello    system.Hello
+	encoding string // Encoding of responses, empty for json
+}
+
+// How long an agent that predates the protocol isn't probed again. Probing
+// costs a full stats request, so it's only repeated to detect agent updates.
+const legacyProbeInterval = time.Hour
+
+// Request sent to an agent
+type agentRequest struct {
+	name     string         // Exec command, empty to open a shell
+	config   string         // Agent settings managed by the hub
+	encoding string         // Response encoding, empty for json
+	interval time.Duration  // Polling interval of the system, sent with stats requests
+	timing   *requestTiming // Set to measure when the response arrives
+}
+
+// Times measured by the hub while requesting data from an agent
+type requestTiming struct {
+	rtt      time.Duration // Round trip time of opening the SSH session
+	received time.Time     // Time the response was decoded
+}
+
+// Returns the difference between the agent and hub clocks in milliseconds.
+// The agent sets its time just before sending the response, which then takes
+// about half a round trip to arrive, so that is subtracted from the time the
+// hub received it.
+func clockDrift(agentTime time.Time, timing requestTiming) float64 {
+	sent := timing.received.Add(-timing.rtt / 2)
+	return float64(agentTime.Sub(sent).Milliseconds())
+}
+
+// Returns true if the agent supports the request
+func (p *agentProtocol) supports(request string) bool {
+	return p.hello.Version > 0 && slices.Contains(p.hello.Capabilities, request)
+}
+
+// Returns the protocol of the agent on the connection, sending a hello request
+// the first time. Agents that predate the protocol answer any request with
+// stats, which decode as version 0 without capabilities.
+func (h *Hub) getAgentProtocol(record *core.Record, client *ssh.Client) (*agentProtocol, error) {
+	if p, ok := h.agentProtocols.Load(record.Id); ok && p.(*agentProtocol).client == client {
+		return p.(*agentProtocol), nil
+	}
+	p := &agentProtocol{client: client}
+	// don't probe legacy agents on every new connection
+	if probed, ok := h.legacyAgents.Load(record.Id); ok && time.Since(probed.(time.Time)) < legacyProbeInterval {
+		h.agentProtocols.Store(record.Id, p)
+		return p, nil
+	}
+	if err := h.requestFromAgent(client, agentRequest{name: "hello", config: agentConfig(record)}, &p.hello); err != nil {
+		return nil, err
+	}
+	// speak the older of the two versions
+	p.hello.Version = min(p.hello.Version, system.ProtocolVersion)
+	if p.hello.Version == 0 {
+		h.legacyAgents.Store(record.Id, time.Now())
+	} else {
+		h.legacyAgents.Delete(record.Id)
+	}
+	// CBOR responses are about 12% smaller, but the hub takes about twice as
+	// long to decode them as json (see the benchmarks in agent/encoding_test.go).
+	// json stays the default to keep the hub's CPU use low, and CBOR is only
+	// used if AGENT_ENCODING=cbor, e.g. for agents on metered connections.
+	if os.Getenv("AGENT_ENCODING") == system.EncodingCBOR && p.hello.Version > 0 && slices.Contains(p.hello.Encodings, system.EncodingCBOR) {
+		p.encoding = system.EncodingCBOR
+	}
+	h.agentProtocols.Store(record.Id, p)
+	h.app.Logger().Debug("Agent protocol", "system", record.GetString("name"), "version", p.hello.Version, "capabilities", p.hello.Capabilities, "encoding", p.encoding)
+	return p, nil
+}
+
+// Fetches system stats from the agent using the request its protocol supports
+func (h *Hub) requestStats(record *core.Record, client *ssh.Client, systemData *system.CombinedData) error {
+	protocol, err := h.getAgentProtocol(record, client)
+	if err != nil {
+		return err
+	}
+	var timing requestTiming
+	request := agentRequest{config: agentConfig(record), interval: records.PollInterval(record), timing: &timing}
+	if protocol.supports("stats") {
+		request.name = "stats"
+		request.encoding = protocol.encoding
+	}
+	if err := h.requestFromAgent(client, request, systemData); err != nil {
+		return err
+	}
+	// compare the agent's clock with the hub's clock (older agents don't send a timestamp)
+	if !systemData.Time.IsZero() {
+		systemData.Stats.ClockDrift = clockDrift(systemData.Time, timing)
+	}
+	return nil
+}
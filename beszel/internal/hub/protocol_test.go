@@ -0,0 +1,333 @@
+//go:build !goexperiment.jsonv2
+
+package hub
+
+import (
+	"beszel/internal/entities/system"
+	"encoding/json"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	sshServer "github.com/gliderlabs/ssh"
+	"github.com/pocketbase/pocketbase/core"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Forwards connections to the address with the latency added in both
+// directions, and returns the address to connect to
+func delayedProxy(t *testing.T, addr string, latency time.Duration) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	type chunk struct {
+		data []byte
+		at   time.Time
+	}
+	forward := func(dst, src net.Conn) {
+		chunks := make(chan chunk, 64)
+		go func() {
+			defer close(chunks)
+			for {
+				buf := make([]byte, 32*1024)
+				n, err := src.Read(buf)
+				if n > 0 {
+					chunks <- chunk{buf[:n], time.Now().Add(latency)}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+		for c := range chunks {
+			time.Sleep(time.Until(c.at))
+			if _, err := dst.Write(c.data); err != nil {
+				break
+			}
+		}
+		dst.Close()
+		src.Close()
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go forward(upstream, conn)
+			go forward(conn, upstream)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// Serves a test agent with the handler on a loopback port and connects the
+// hub to it through a proxy with the latency
+func dialTestAgent(t *testing.T, h *Hub, latency time.Duration, handler sshServer.Handler) (*gossh.Client, *core.Record) {
+	t.Helper()
+	if err := h.createSSHClientConfig(); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestAgentServer(t, h)
+	server.Handler = handler
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	_, systemRecord := createTestSystem(t, h.app)
+	addr := listener.Addr().String()
+	if latency > 0 {
+		addr = delayedProxy(t, addr, latency)
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	systemRecord.Set("host", host)
+	systemRecord.Set("port", port)
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	client, err := h.createSystemConnection(systemRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, systemRecord
+}
+
+func TestClockDrift(t *testing.T) {
+	received := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		agentTime time.Time
+		rtt       time.Duration
+		want      float64
+	}{
+		{name: "local agent", agentTime: received, want: 0},
+		// the response left the agent 150ms before it arrived
+		{name: "synced clocks", agentTime: received.Add(-150 * time.Millisecond), rtt: 300 * time.Millisecond, want: 0},
+		{name: "agent ahead", agentTime: received.Add(1850 * time.Millisecond), rtt: 300 * time.Millisecond, want: 2000},
+		{name: "agent behind", agentTime: received.Add(-2150 * time.Millisecond), rtt: 300 * time.Millisecond, want: -2000},
+		{name: "agent behind by the latency", agentTime: received.Add(-300 * time.Millisecond), rtt: 300 * time.Millisecond, want: -150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clockDrift(tt.agentTime, requestTiming{rtt: tt.rtt, received: received}); got != tt.want {
+				t.Errorf("clockDrift() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestStatsClockDrift(t *testing.T) {
+	h := newTestHub(t)
+	// an agent with a clock 5s ahead that is 100ms away and takes a second
+	// to collect stats
+	client, systemRecord := dialTestAgent(t, h, 100*time.Millisecond, func(s sshServer.Session) {
+		var response any = system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}}
+		if s.RawCommand() == "stats" {
+			time.Sleep(time.Second)
+			response = system.CombinedData{Time: time.Now().Add(5 * time.Second).UTC()}
+		}
+		json.NewEncoder(s).Encode(response)
+		s.Exit(0)
+	})
+
+	var systemData system.CombinedData
+	if err := h.requestStats(systemRecord, client, &systemData); err != nil {
+		t.Fatal(err)
+	}
+	// neither the latency nor the time spent collecting stats is drift
+	if drift := systemData.Stats.ClockDrift; drift < 4950 || drift > 5050 {
+		t.Errorf("ClockDrift = %v, want about 5000", drift)
+	}
+}
+
+// Test agent that records the requests it receives. Agents that predate the
+// protocol answer every request with stats.
+type recordingAgent struct {
+	sync.Mutex
+	hello    *system.Hello // nil for an agent that predates the protocol
+	requests []string      // exec command, or "shell", and the requested encoding
+}
+
+func (a *recordingAgent) handle(s sshServer.Session) {
+	a.Lock()
+	request := s.RawCommand()
+	if request == "" {
+		request = "shell"
+	}
+	var encoding string
+	for _, env := range s.Environ() {
+		if value, ok := strings.CutPrefix(env, "BESZEL_ENCODING="); ok {
+			encoding = value
+			request += " " + encoding
+		}
+	}
+	a.requests = append(a.requests, request)
+	var response any = system.CombinedData{Info: system.Info{Hostname: "agent"}}
+	if a.hello != nil && request == "hello" {
+		response = a.hello
+	}
+	a.Unlock()
+	if encoding == system.EncodingCBOR {
+		cbor.NewEncoder(s).Encode(response)
+	} else {
+		json.NewEncoder(s).Encode(response)
+	}
+	s.Exit(0)
+}
+
+// Returns the requests received since the last call
+func (a *recordingAgent) received() []string {
+	a.Lock()
+	defer a.Unlock()
+	requests := a.requests
+	a.requests = nil
+	return requests
+}
+
+func TestAgentProtocolNegotiation(t *testing.T) {
+	tests := []struct {
+		name         string
+		hello        *system.Hello
+		cbor         bool // hub set to prefer CBOR
+		wantVersion  int
+		wantRequests []string // sent by two stats requests
+	}{
+		{
+			name:         "current agent",
+			hello:        &system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}, Encodings: []string{"json", "cbor"}},
+			wantVersion:  system.ProtocolVersion,
+			wantRequests: []string{"hello", "stats", "stats"},
+		},
+		{
+			name:         "cbor preferred",
+			hello:        &system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}, Encodings: []string{"json", "cbor"}},
+			cbor:         true,
+			wantVersion:  system.ProtocolVersion,
+			wantRequests: []string{"hello", "stats cbor", "stats cbor"},
+		},
+		{
+			name:         "cbor preferred but not supported",
+			hello:        &system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}},
+			cbor:         true,
+			wantVersion:  system.ProtocolVersion,
+			wantRequests: []string{"hello", "stats", "stats"},
+		},
+		{
+			name:         "newer agent",
+			hello:        &system.Hello{Version: system.ProtocolVersion + 1, Capabilities: []string{"hello", "stats", "unknown"}},
+			wantVersion:  system.ProtocolVersion,
+			wantRequests: []string{"hello", "stats", "stats"},
+		},
+		{
+			name:         "agent without stats request",
+			hello:        &system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello"}},
+			wantVersion:  system.ProtocolVersion,
+			wantRequests: []string{"hello", "shell", "shell"},
+		},
+		{
+			name:         "legacy agent",
+			wantVersion:  0,
+			wantRequests: []string{"hello", "shell", "shell"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cbor {
+				t.Setenv("AGENT_ENCODING", system.EncodingCBOR)
+			}
+			h := newTestHub(t)
+			agent := &recordingAgent{hello: tt.hello}
+			client, systemRecord := dialTestAgent(t, h, 0, agent.handle)
+
+			// the protocol is negotiated once per connection
+			for range 2 {
+				var systemData system.CombinedData
+				if err := h.requestStats(systemRecord, client, &systemData); err != nil {
+					t.Fatal(err)
+				}
+				if systemData.Info.Hostname != "agent" {
+					t.Errorf("got hostname %q, want agent", systemData.Info.Hostname)
+				}
+			}
+			if requests := agent.received(); !slices.Equal(requests, tt.wantRequests) {
+				t.Errorf("got requests %q, want %q", requests, tt.wantRequests)
+			}
+			p, err := h.getAgentProtocol(systemRecord, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.hello.Version != tt.wantVersion {
+				t.Errorf("got version %d, want %d", p.hello.Version, tt.wantVersion)
+			}
+			_, legacy := h.legacyAgents.Load(systemRecord.Id)
+			if legacy != (tt.wantVersion == 0) {
+				t.Errorf("legacy = %v, want %v", legacy, tt.wantVersion == 0)
+			}
+		})
+	}
+}
+
+func TestLegacyAgentProbe(t *testing.T) {
+	h := newTestHub(t)
+	agent := &recordingAgent{}
+	client, systemRecord := dialTestAgent(t, h, 0, agent.handle)
+	reconnect := func() {
+		t.Helper()
+		h.deleteSystemConnection(systemRecord)
+		var err error
+		if client, err = h.createSystemConnection(systemRecord); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+	}
+	requestStats := func() {
+		t.Helper()
+		var systemData system.CombinedData
+		if err := h.requestStats(systemRecord, client, &systemData); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requestStats()
+	if requests := agent.received(); !slices.Equal(requests, []string{"hello", "shell"}) {
+		t.Fatalf("first connection: got requests %q, want hello and shell", requests)
+	}
+
+	// a new connection within the probe interval isn't probed again
+	reconnect()
+	requestStats()
+	if requests := agent.received(); !slices.Equal(requests, []string{"shell"}) {
+		t.Errorf("reconnection: got requests %q, want shell", requests)
+	}
+
+	// the agent is probed again once the interval has passed, and found to
+	// be updated
+	h.legacyAgents.Store(systemRecord.Id, time.Now().Add(-legacyProbeInterval-time.Minute))
+	agent.Lock()
+	agent.hello = &system.Hello{Version: system.ProtocolVersion, Capabilities: []string{"hello", "stats"}}
+	agent.Unlock()
+	reconnect()
+	requestStats()
+	if requests := agent.received(); !slices.Equal(requests, []string{"hello", "stats"}) {
+		t.Errorf("after the probe interval: got requests %q, want hello and stats", requests)
+	}
+	if _, ok := h.legacyAgents.Load(systemRecord.Id); ok {
+		t.Error("updated agent is still legacy")
+	}
+}
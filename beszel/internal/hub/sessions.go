@@ -0,0 +1,24 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Returns the time after which sessions are new logins, and sets the agent
+// time the next poll checks from. The agent's clock is used because it also
+// sets the session start times.
+func sessionsSince(record *core.Record, agentTime time.Time) time.Time {
+	since := record.GetDateTime("sessions_checked").Time()
+	if since.IsZero() {
+		// first poll of the system or since the field was added
+		since = record.GetDateTime("updated").Time()
+	}
+	// older agents don't send their time
+	if agentTime.IsZero() {
+		agentTime = time.Now()
+	}
+	record.Set("sessions_checked", agentTime)
+	return since
+}
@@ -0,0 +1,51 @@
+//go:build !goexperiment.jsonv2
+
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionsSince(t *testing.T) {
+	h := newTestHub(t)
+	_, systemRecord := createTestSystem(t, h.app)
+	updated := systemRecord.GetDateTime("updated").Time()
+
+	// the first poll checks from the last update of the record
+	firstPoll := time.Now().UTC().Add(time.Minute).Truncate(time.Millisecond)
+	if since := sessionsSince(systemRecord, firstPoll); !since.Equal(updated) {
+		t.Errorf("first poll: since = %v, want updated %v", since, updated)
+	}
+	if err := h.app.SaveNoValidate(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+
+	// editing the system changes updated but not the time sessions are
+	// checked from
+	systemRecord, err := h.app.FindRecordById("systems", systemRecord.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemRecord.Set("name", "renamed")
+	if err := h.app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	systemRecord, err = h.app.FindRecordById("systems", systemRecord.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPoll := firstPoll.Add(time.Minute)
+	if since := sessionsSince(systemRecord, secondPoll); !since.Equal(firstPoll) {
+		t.Errorf("after edit: since = %v, want first poll %v", since, firstPoll)
+	}
+
+	// agents that don't send their time check from the hub's clock
+	before := time.Now()
+	if since := sessionsSince(systemRecord, time.Time{}); !since.Equal(secondPoll) {
+		t.Errorf("no agent time: since = %v, want second poll %v", since, secondPoll)
+	}
+	if checked := systemRecord.GetDateTime("sessions_checked").Time(); checked.Before(before.Truncate(time.Millisecond)) {
+		t.Errorf("no agent time: sessions_checked = %v, want at least %v", checked, before)
+	}
+}
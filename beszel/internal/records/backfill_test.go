@@ -0,0 +1,102 @@
+//go:build !goexperiment.jsonv2
+
+// PocketBase collections don't decode with encoding/json v2, so these tests
+// only build with the json package of Go 1.23 or GOEXPERIMENT=nojsonv2.
+
+package records
+
+import (
+	_ "beszel/migrations"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestCreateBackfillRecords(t *testing.T) {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	defer app.ResetBootstrapState()
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	users, _ := app.FindCollectionByNameOrId("users")
+	user := core.NewRecord(users)
+	user.SetEmail("test@example.com")
+	user.SetPassword("testpassword")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	systems, _ := app.FindCollectionByNameOrId("systems")
+	systemRecord := core.NewRecord(systems)
+	systemRecord.Set("name", "test")
+	systemRecord.Set("host", "127.0.0.1")
+	systemRecord.Set("port", "45876")
+	systemRecord.Set("users", user.Id)
+	if err := app.Save(systemRecord); err != nil {
+		t.Fatal(err)
+	}
+	systemStats, err := app.FindCollectionByNameOrId("system_stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(recordType string, created time.Time) {
+		record := core.NewRecord(systemStats)
+		record.Set("system", systemRecord.Id)
+		record.Set("type", recordType)
+		record.Set("stats", map[string]any{"cpu": 10})
+		date, _ := types.ParseDateTime(created)
+		record.SetRaw("created", date)
+		record.SetRaw("updated", date)
+		if err := app.SaveNoValidate(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an outage from 00:05 to 02:25 backfilled with 1m records, after a 10m
+	// record created by the cron job just after 00:10
+	start := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	from, to := start.Add(5*time.Minute), start.Add(145*time.Minute)
+	for created := from.Add(time.Minute); !created.After(to); created = created.Add(time.Minute) {
+		save("1m", created)
+	}
+	save("10m", start.Add(10*time.Minute+2*time.Second))
+
+	rm := &RecordManager{app}
+	rm.CreateBackfillRecords(systemRecord.Id, []*core.Collection{systemStats}, from, to)
+	// running again doesn't create duplicates
+	rm.CreateBackfillRecords(systemRecord.Id, []*core.Collection{systemStats}, from, to)
+
+	want := map[string][]time.Duration{
+		// the record created by the cron job at 00:10 is kept
+		"10m": {10*time.Minute + 2*time.Second, 20 * time.Minute, 30 * time.Minute, 40 * time.Minute, 50 * time.Minute, 60 * time.Minute,
+			70 * time.Minute, 80 * time.Minute, 90 * time.Minute, 100 * time.Minute, 110 * time.Minute, 120 * time.Minute,
+			130 * time.Minute, 140 * time.Minute},
+		"20m":  {20 * time.Minute, 40 * time.Minute, 60 * time.Minute, 80 * time.Minute, 100 * time.Minute, 120 * time.Minute, 140 * time.Minute},
+		"120m": {120 * time.Minute},
+	}
+	for recordType, offsets := range want {
+		records, err := app.FindRecordsByFilter(systemStats, "type = {:type}", "created", 0, 0, map[string]any{"type": recordType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != len(offsets) {
+			got := make([]time.Duration, 0, len(records))
+			for _, record := range records {
+				got = append(got, record.GetDateTime("created").Time().Sub(start))
+			}
+			t.Errorf("%s: got records at %v, want %v", recordType, got, offsets)
+			continue
+		}
+		for i, record := range records {
+			if created := record.GetDateTime("created").Time(); !created.Equal(start.Add(offsets[i])) {
+				t.Errorf("%s: record %d created at %v, want %v", recordType, i, created.Sub(start), offsets[i])
+			}
+		}
+	}
+}
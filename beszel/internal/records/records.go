@@ -2,8 +2,10 @@
 package records
 
 import (
+	"beszel/internal/entities/check"
 	"beszel/internal/entities/container"
 	"beszel/internal/entities/system"
+	"beszel/internal/entities/vm"
 	"log"
 	"math"
 	"time"
@@ -26,6 +28,17 @@ type LongerRecordData struct {
 	minShorterRecords  int
 }
 
+// Low values of a system_stats record. Fields are nil if the record predates
+// sampling between polls, since zero is a valid low value.
+type recordLows struct {
+	Cpu         *float64 `json:"cpun"`
+	MemUsed     *float64 `json:"mun"`
+	DiskReadPs  *float64 `json:"drn"`
+	DiskWritePs *float64 `json:"dwn"`
+	NetworkSent *float64 `json:"nsn"`
+	NetworkRecv *float64 `json:"nrn"`
+}
+
 type RecordDeletionData struct {
 	recordType string
 	retention  time.Duration
@@ -35,6 +48,60 @@ type RecordStats []struct {
 	Stats []byte `db:"stats"`
 }
 
+// Record type saved on every poll of systems polled more than once a minute
+const HighResType = "10s"
+
+// Shortest polling interval a system can be configured with
+const MinPollInterval = 10 * time.Second
+
+// How long system events are kept
+const eventRetention = 7 * 24 * time.Hour
+
+// Returns how often a system is polled, once a minute if its interval isn't set
+func PollInterval(system *core.Record) time.Duration {
+	if interval := system.GetInt("interval"); interval > 0 {
+		return max(time.Duration(interval)*time.Second, MinPollInterval)
+	}
+	return time.Minute
+}
+
+// Returns the record type saved on every poll of a system
+func PollRecordType(system *core.Record) string {
+	if PollInterval(system) < time.Minute {
+		return HighResType
+	}
+	return "1m"
+}
+
+// Longer record types and the shorter records they average
+var longerRecordData = []LongerRecordData{
+	{
+		shorterType: "1m",
+		// change to 9 from 10 to allow edge case timing or short pauses
+		minShorterRecords:  9,
+		longerType:         "10m",
+		longerTimeDuration: -10 * time.Minute,
+	},
+	{
+		shorterType:        "10m",
+		minShorterRecords:  2,
+		longerType:         "20m",
+		longerTimeDuration: -20 * time.Minute,
+	},
+	{
+		shorterType:        "20m",
+		minShorterRecords:  6,
+		longerType:         "120m",
+		longerTimeDuration: -120 * time.Minute,
+	},
+	{
+		shorterType:        "120m",
+		minShorterRecords:  4,
+		longerType:         "480m",
+		longerTimeDuration: -480 * time.Minute,
+	},
+}
+
 func NewRecordManager(app *pocketbase.PocketBase) *RecordManager {
 	return &RecordManager{app}
 }
@@ -42,33 +109,6 @@ func NewRecordManager(app *pocketbase.PocketBase) *RecordManager {
 // Create longer records by averaging shorter records
 func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
 	// start := time.Now()
-	longerRecordData := []LongerRecordData{
-		{
-			shorterType: "1m",
-			// change to 9 from 10 to allow edge case timing or short pauses
-			minShorterRecords:  9,
-			longerType:         "10m",
-			longerTimeDuration: -10 * time.Minute,
-		},
-		{
-			shorterType:        "10m",
-			minShorterRecords:  2,
-			longerType:         "20m",
-			longerTimeDuration: -20 * time.Minute,
-		},
-		{
-			shorterType:        "20m",
-			minShorterRecords:  6,
-			longerType:         "120m",
-			longerTimeDuration: -120 * time.Minute,
-		},
-		{
-			shorterType:        "120m",
-			minShorterRecords:  4,
-			longerType:         "480m",
-			longerTimeDuration: -480 * time.Minute,
-		},
-	}
 	// wrap the operations in a transaction
 	rm.app.RunInTransaction(func(txApp core.App) error {
 		activeSystems, err := txApp.FindAllRecords("systems", dbx.NewExp("status = 'up'"))
@@ -119,7 +159,7 @@ func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
 						All(&stats)
 
 					// continue if not enough shorter records
-					if err != nil || len(stats) < recordData.minShorterRecords {
+					if err != nil || len(stats) < minShorterRecords(recordData, system) {
 						// log.Println("not enough shorter records. continue.", len(allShorterRecords), recordData.expectedShorterRecords)
 						continue
 					}
@@ -127,12 +167,7 @@ func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
 					longerRecord := core.NewRecord(collection)
 					longerRecord.Set("system", system.Id)
 					longerRecord.Set("type", recordData.longerType)
-					switch collection.Name {
-					case "system_stats":
-						longerRecord.Set("stats", rm.AverageSystemStats(stats))
-					case "container_stats":
-						longerRecord.Set("stats", rm.AverageContainerStats(stats))
-					}
+					longerRecord.Set("stats", rm.averageStats(collection.Name, stats))
 					if err := txApp.SaveNoValidate(longerRecord); err != nil {
 						log.Println("failed to save longer record", "err", err.Error())
 					}
@@ -146,17 +181,150 @@ func (rm *RecordManager) CreateLongerRecords(collections []*core.Collection) {
 	// log.Println("finished creating longer records", "time (ms)", time.Since(start).Milliseconds())
 }
 
+// Creates 1m records by averaging the high resolution records of systems polled
+// more than once a minute. Runs every minute.
+func (rm *RecordManager) CreateMinuteRecords(collections []*core.Collection) {
+	rm.app.RunInTransaction(func(txApp core.App) error {
+		highResSystems, err := txApp.FindAllRecords("systems", dbx.NewExp("status = 'up' AND interval > 0 AND interval < 60"))
+		if err != nil {
+			log.Println("failed to get high resolution systems", "err", err.Error())
+			return err
+		}
+		since := time.Now().UTC().Add(-time.Minute)
+		for _, system := range highResSystems {
+			for _, collection := range collections {
+				var stats RecordStats
+				err := txApp.DB().
+					Select("stats").
+					From(collection.Name).
+					AndWhere(dbx.NewExp(
+						"type={:type} AND system={:system} AND created > {:created}",
+						dbx.Params{"type": HighResType, "system": system.Id, "created": since},
+					)).
+					All(&stats)
+				if err != nil || len(stats) == 0 {
+					continue
+				}
+				minuteRecord := core.NewRecord(collection)
+				minuteRecord.Set("system", system.Id)
+				minuteRecord.Set("type", "1m")
+				minuteRecord.Set("stats", rm.averageStats(collection.Name, stats))
+				if err := txApp.SaveNoValidate(minuteRecord); err != nil {
+					log.Println("failed to save minute record", "err", err.Error())
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Returns the number of shorter records needed to create a longer record. Systems
+// polled less than once a minute have fewer 1m records, so 90% of the expected
+// number is enough.
+func minShorterRecords(recordData LongerRecordData, system *core.Record) int {
+	interval := PollInterval(system)
+	if recordData.shorterType != "1m" || interval <= time.Minute {
+		return recordData.minShorterRecords
+	}
+	expected := -recordData.longerTimeDuration / interval
+	return min(recordData.minShorterRecords, max(1, int(expected)*9/10))
+}
+
+// Creates longer records for a period filled with backfilled 1m records, which
+// CreateLongerRecords misses because it only averages the most recent records.
+// Periods are aligned to multiples of their length and records are created at the
+// end of each period, as if they had been created on time. Periods overlapping an
+// existing longer record are skipped. The period in progress is left to
+// CreateLongerRecords, which averages the records since the previous longer record.
+func (rm *RecordManager) CreateBackfillRecords(systemId string, collections []*core.Collection, from, to time.Time) {
+	rm.app.RunInTransaction(func(txApp core.App) error {
+		for _, recordData := range longerRecordData {
+			period := -recordData.longerTimeDuration
+			for end := from.Truncate(period).Add(period); !end.After(to); end = end.Add(period) {
+				start := end.Add(-period)
+				for _, collection := range collections {
+					// a longer record created at t averages the period before t, so
+					// records created before the end of the next period overlap this one.
+					// Allow a minute for records created slightly after the cron job runs.
+					existing, err := txApp.FindFirstRecordByFilter(
+						collection.Id,
+						"type = {:type} && system = {:system} && created > {:start} && created < {:end}",
+						dbx.Params{
+							"type":   recordData.longerType,
+							"system": systemId,
+							"start":  start.Add(time.Minute).UTC().Format(types.DefaultDateLayout),
+							"end":    end.Add(period).UTC().Format(types.DefaultDateLayout),
+						},
+					)
+					if err == nil || existing != nil {
+						continue
+					}
+					var stats RecordStats
+					err = txApp.DB().
+						Select("stats").
+						From(collection.Name).
+						AndWhere(dbx.NewExp(
+							"type={:type} AND system={:system} AND created > {:start} AND created <= {:end}",
+							dbx.Params{
+								"type":   recordData.shorterType,
+								"system": systemId,
+								"start":  start.UTC().Format(types.DefaultDateLayout),
+								"end":    end.UTC().Format(types.DefaultDateLayout),
+							},
+						)).
+						All(&stats)
+					if err != nil || len(stats) < recordData.minShorterRecords {
+						continue
+					}
+					longerRecord := core.NewRecord(collection)
+					longerRecord.Set("system", systemId)
+					longerRecord.Set("type", recordData.longerType)
+					longerRecord.Set("stats", rm.averageStats(collection.Name, stats))
+					created, _ := types.ParseDateTime(end)
+					longerRecord.SetRaw("created", created)
+					longerRecord.SetRaw("updated", created)
+					if err := txApp.SaveNoValidate(longerRecord); err != nil {
+						log.Println("failed to save longer record", "err", err.Error())
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Averages records of the collection
+func (rm *RecordManager) averageStats(collectionName string, stats RecordStats) any {
+	switch collectionName {
+	case "system_stats":
+		return rm.AverageSystemStats(stats)
+	case "container_stats":
+		return rm.AverageContainerStats(stats)
+	case "check_stats":
+		return rm.AverageCheckStats(stats)
+	case "vm_stats":
+		return rm.AverageVmStats(stats)
+	}
+	return nil
+}
+
 // Calculate the average stats of a list of system_stats records without reflect
 func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 	sum := system.Stats{}
 	count := float64(len(records))
 	// use different counter for temps in case some records don't have them
 	tempCount := float64(0)
+	// custom metrics may come and go, so count each key separately
+	customCounts := make(map[string]float64)
+	logCounts := make(map[string]float64)
 
 	var stats system.Stats
+	var lows recordLows
 	for i := range records {
 		stats = system.Stats{} // Zero the struct before unmarshalling
 		json.Unmarshal(records[i].Stats, &stats)
+		lows = recordLows{}
+		json.Unmarshal(records[i].Stats, &lows)
 		sum.Cpu += stats.Cpu
 		sum.Mem += stats.Mem
 		sum.MemUsed += stats.MemUsed
@@ -172,12 +340,23 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 		sum.DiskWritePs += stats.DiskWritePs
 		sum.NetworkSent += stats.NetworkSent
 		sum.NetworkRecv += stats.NetworkRecv
+		sum.FailedLogins += stats.FailedLogins
+		sum.ClockOffset += stats.ClockOffset
+		sum.ClockDrift += stats.ClockDrift
 		// set peak values
 		sum.MaxCpu = max(sum.MaxCpu, stats.MaxCpu, stats.Cpu)
+		sum.MaxMemUsed = max(sum.MaxMemUsed, stats.MaxMemUsed, stats.MemUsed)
 		sum.MaxNetworkSent = max(sum.MaxNetworkSent, stats.MaxNetworkSent, stats.NetworkSent)
 		sum.MaxNetworkRecv = max(sum.MaxNetworkRecv, stats.MaxNetworkRecv, stats.NetworkRecv)
 		sum.MaxDiskReadPs = max(sum.MaxDiskReadPs, stats.MaxDiskReadPs, stats.DiskReadPs)
 		sum.MaxDiskWritePs = max(sum.MaxDiskWritePs, stats.MaxDiskWritePs, stats.DiskWritePs)
+		// set low values
+		sum.MinCpu = lowest(i, sum.MinCpu, lows.Cpu, stats.Cpu)
+		sum.MinMemUsed = lowest(i, sum.MinMemUsed, lows.MemUsed, stats.MemUsed)
+		sum.MinNetworkSent = lowest(i, sum.MinNetworkSent, lows.NetworkSent, stats.NetworkSent)
+		sum.MinNetworkRecv = lowest(i, sum.MinNetworkRecv, lows.NetworkRecv, stats.NetworkRecv)
+		sum.MinDiskReadPs = lowest(i, sum.MinDiskReadPs, lows.DiskReadPs, stats.DiskReadPs)
+		sum.MinDiskWritePs = lowest(i, sum.MinDiskWritePs, lows.DiskWritePs, stats.DiskWritePs)
 		// add temps to sum
 		if stats.Temperatures != nil {
 			if sum.Temperatures == nil {
@@ -191,6 +370,31 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 				sum.Temperatures[key] += value
 			}
 		}
+		// add custom metrics to sum
+		if stats.Custom != nil {
+			if sum.Custom == nil {
+				sum.Custom = make(map[string]float64, len(stats.Custom))
+			}
+			for key, value := range stats.Custom {
+				sum.Custom[key] += value
+				customCounts[key]++
+			}
+		}
+		// add log matches to sum, keeping the most recent matched line
+		if stats.LogMatches != nil {
+			if sum.LogMatches == nil {
+				sum.LogMatches = make(map[string]system.LogMatch, len(stats.LogMatches))
+			}
+			for key, value := range stats.LogMatches {
+				match := sum.LogMatches[key]
+				match.Count += value.Count
+				if value.LastLine != "" {
+					match.LastLine = value.LastLine
+				}
+				sum.LogMatches[key] = match
+				logCounts[key]++
+			}
+		}
 		// add extra fs to sum
 		if stats.ExtraFs != nil {
 			if sum.ExtraFs == nil {
@@ -246,11 +450,21 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 		DiskWritePs:    twoDecimals(sum.DiskWritePs / count),
 		NetworkSent:    twoDecimals(sum.NetworkSent / count),
 		NetworkRecv:    twoDecimals(sum.NetworkRecv / count),
+		FailedLogins:   twoDecimals(sum.FailedLogins / count),
+		ClockOffset:    twoDecimals(sum.ClockOffset / count),
+		ClockDrift:     twoDecimals(sum.ClockDrift / count),
 		MaxCpu:         sum.MaxCpu,
+		MaxMemUsed:     sum.MaxMemUsed,
 		MaxDiskReadPs:  sum.MaxDiskReadPs,
 		MaxDiskWritePs: sum.MaxDiskWritePs,
 		MaxNetworkSent: sum.MaxNetworkSent,
 		MaxNetworkRecv: sum.MaxNetworkRecv,
+		MinCpu:         sum.MinCpu,
+		MinMemUsed:     sum.MinMemUsed,
+		MinDiskReadPs:  sum.MinDiskReadPs,
+		MinDiskWritePs: sum.MinDiskWritePs,
+		MinNetworkSent: sum.MinNetworkSent,
+		MinNetworkRecv: sum.MinNetworkRecv,
 	}
 
 	if sum.Temperatures != nil {
@@ -260,6 +474,23 @@ func (rm *RecordManager) AverageSystemStats(records RecordStats) system.Stats {
 		}
 	}
 
+	if sum.Custom != nil {
+		stats.Custom = make(map[string]float64, len(sum.Custom))
+		for key, value := range sum.Custom {
+			stats.Custom[key] = twoDecimals(value / customCounts[key])
+		}
+	}
+
+	if sum.LogMatches != nil {
+		stats.LogMatches = make(map[string]system.LogMatch, len(sum.LogMatches))
+		for key, value := range sum.LogMatches {
+			stats.LogMatches[key] = system.LogMatch{
+				Count:    twoDecimals(value.Count / logCounts[key]),
+				LastLine: value.LastLine,
+			}
+		}
+	}
+
 	if sum.ExtraFs != nil {
 		stats.ExtraFs = make(map[string]*system.FsStats, len(sum.ExtraFs))
 		for key, value := range sum.ExtraFs {
@@ -313,6 +544,8 @@ func (rm *RecordManager) AverageContainerStats(records RecordStats) []container.
 			sums[stat.Name].Mem += stat.Mem
 			sums[stat.Name].NetworkSent += stat.NetworkSent
 			sums[stat.Name].NetworkRecv += stat.NetworkRecv
+			sums[stat.Name].DiskRead += stat.DiskRead
+			sums[stat.Name].DiskWrite += stat.DiskWrite
 		}
 	}
 
@@ -324,6 +557,89 @@ func (rm *RecordManager) AverageContainerStats(records RecordStats) []container.
 			Mem:         twoDecimals(value.Mem / count),
 			NetworkSent: twoDecimals(value.NetworkSent / count),
 			NetworkRecv: twoDecimals(value.NetworkRecv / count),
+			DiskRead:    twoDecimals(value.DiskRead / count),
+			DiskWrite:   twoDecimals(value.DiskWrite / count),
+		})
+	}
+	return result
+}
+
+// Calculate the average stats of a list of vm_stats records
+func (rm *RecordManager) AverageVmStats(records RecordStats) []vm.Stats {
+	sums := make(map[string]*vm.Stats)
+	count := float64(len(records))
+
+	var vmStats []vm.Stats
+	for i := range records {
+		vmStats = vmStats[:0]
+		if err := json.Unmarshal(records[i].Stats, &vmStats); err != nil {
+			return []vm.Stats{}
+		}
+		for i := range vmStats {
+			stat := vmStats[i]
+			if _, ok := sums[stat.Name]; !ok {
+				sums[stat.Name] = &vm.Stats{Name: stat.Name}
+			}
+			// keep the latest vcpu count and state
+			sums[stat.Name].Vcpus = stat.Vcpus
+			sums[stat.Name].State = stat.State
+			sums[stat.Name].Cpu += stat.Cpu
+			sums[stat.Name].Mem += stat.Mem
+			sums[stat.Name].DiskRead += stat.DiskRead
+			sums[stat.Name].DiskWrite += stat.DiskWrite
+			sums[stat.Name].NetworkSent += stat.NetworkSent
+			sums[stat.Name].NetworkRecv += stat.NetworkRecv
+		}
+	}
+
+	result := make([]vm.Stats, 0, len(sums))
+	for _, value := range sums {
+		result = append(result, vm.Stats{
+			Name:        value.Name,
+			Vcpus:       value.Vcpus,
+			State:       value.State,
+			Cpu:         twoDecimals(value.Cpu / count),
+			Mem:         twoDecimals(value.Mem / count),
+			DiskRead:    twoDecimals(value.DiskRead / count),
+			DiskWrite:   twoDecimals(value.DiskWrite / count),
+			NetworkSent: twoDecimals(value.NetworkSent / count),
+			NetworkRecv: twoDecimals(value.NetworkRecv / count),
+		})
+	}
+	return result
+}
+
+// Calculate the average stats of a list of check_stats records.
+// Up becomes the fraction of records in which the check succeeded.
+func (rm *RecordManager) AverageCheckStats(records RecordStats) []check.Stats {
+	sums := make(map[string]*check.Stats)
+	counts := make(map[string]float64)
+
+	var checkStats []check.Stats
+	for i := range records {
+		checkStats = checkStats[:0]
+		if err := json.Unmarshal(records[i].Stats, &checkStats); err != nil {
+			return []check.Stats{}
+		}
+		for i := range checkStats {
+			stat := checkStats[i]
+			if _, ok := sums[stat.Name]; !ok {
+				sums[stat.Name] = &check.Stats{Name: stat.Name, Type: stat.Type}
+			}
+			sums[stat.Name].Up += stat.Up
+			sums[stat.Name].Latency += stat.Latency
+			counts[stat.Name]++
+		}
+	}
+
+	result := make([]check.Stats, 0, len(sums))
+	for name, value := range sums {
+		count := counts[name]
+		result = append(result, check.Stats{
+			Name:    value.Name,
+			Type:    value.Type,
+			Up:      twoDecimals(value.Up / count),
+			Latency: twoDecimals(value.Latency / count),
 		})
 	}
 	return result
@@ -331,8 +647,12 @@ func (rm *RecordManager) AverageContainerStats(records RecordStats) []container.
 
 // Deletes records older than what is displayed in the UI
 func (rm *RecordManager) DeleteOldRecords() {
-	collections := []string{"system_stats", "container_stats"}
+	collections := []string{"system_stats", "container_stats", "check_stats", "vm_stats"}
 	recordData := []RecordDeletionData{
+		{
+			recordType: HighResType,
+			retention:  time.Hour,
+		},
 		{
 			recordType: "1m",
 			retention:  time.Hour,
@@ -365,6 +685,25 @@ func (rm *RecordManager) DeleteOldRecords() {
 			}
 		}
 	}
+	// system events are not averaged, so they're deleted by age only
+	formattedDate := time.Now().UTC().Add(-eventRetention).Format(types.DefaultDateLayout)
+	if _, err := db.Delete("system_events", dbx.NewExp("[[created]] < {:date}", dbx.Params{"date": formattedDate})).Execute(); err != nil {
+		rm.app.Logger().Error("Failed to delete records", "err", err.Error())
+	}
+}
+
+// Returns the lower of the running low value and a record's low value, starting
+// with the record at index 0. Records without a low value (from agents that don't
+// sample between polls, or averaged before sampling was added) use the average.
+func lowest(index int, current float64, recordMin *float64, recordAvg float64) float64 {
+	low := recordAvg
+	if recordMin != nil {
+		low = *recordMin
+	}
+	if index == 0 {
+		return low
+	}
+	return min(current, low)
 }
 
 /* Round float to two decimals */
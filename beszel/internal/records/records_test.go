@@ -0,0 +1,152 @@
+package records
+
+import (
+	"beszel/internal/entities/system"
+	"maps"
+	"testing"
+)
+
+func TestAverageSystemStatsCustom(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		want    map[string]float64
+	}{
+		{
+			name:    "no custom metrics",
+			records: []string{`{"cpu":1}`, `{"cpu":2}`},
+			want:    nil,
+		},
+		{
+			name:    "same metrics",
+			records: []string{`{"cu":{"queue":10,"temp":40.5}}`, `{"cu":{"queue":20,"temp":41}}`},
+			want:    map[string]float64{"queue": 15, "temp": 40.75},
+		},
+		{
+			// metrics are averaged over the records that have them
+			name:    "metric added later",
+			records: []string{`{"cu":{"queue":10}}`, `{"cu":{"queue":20,"jobs":3}}`, `{}`},
+			want:    map[string]float64{"queue": 15, "jobs": 3},
+		},
+		{
+			name:    "rounded",
+			records: []string{`{"cu":{"ratio":1}}`, `{"cu":{"ratio":0}}`, `{"cu":{"ratio":0}}`},
+			want:    map[string]float64{"ratio": 0.33},
+		},
+	}
+	rm := &RecordManager{}
+	for _, tt := range tests {
+		stats := rm.AverageSystemStats(testRecordStats(tt.records...))
+		if !maps.Equal(stats.Custom, tt.want) || (stats.Custom == nil) != (tt.want == nil) {
+			t.Errorf("%s: got %v, want %v", tt.name, stats.Custom, tt.want)
+		}
+	}
+}
+
+func TestAverageSystemStatsLogMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		want    map[string]system.LogMatch
+	}{
+		{
+			name:    "no matches",
+			records: []string{`{"cpu":1}`},
+			want:    nil,
+		},
+		{
+			// the last line is from the latest record that has one
+			name: "counts averaged",
+			records: []string{
+				`{"lm":{"oom":{"c":2,"l":"first"}}}`,
+				`{"lm":{"oom":{"c":4,"l":"second"}}}`,
+				`{"lm":{"oom":{"c":0}}}`,
+			},
+			want: map[string]system.LogMatch{"oom": {Count: 2, LastLine: "second"}},
+		},
+		{
+			name: "patterns averaged separately",
+			records: []string{
+				`{"lm":{"oom":{"c":3,"l":"killed"}}}`,
+				`{"lm":{"oom":{"c":1},"panic":{"c":1,"l":"panic: x"}}}`,
+			},
+			want: map[string]system.LogMatch{"oom": {Count: 2, LastLine: "killed"}, "panic": {Count: 1, LastLine: "panic: x"}},
+		},
+	}
+	rm := &RecordManager{}
+	for _, tt := range tests {
+		stats := rm.AverageSystemStats(testRecordStats(tt.records...))
+		if !maps.Equal(stats.LogMatches, tt.want) || (stats.LogMatches == nil) != (tt.want == nil) {
+			t.Errorf("%s: got %v, want %v", tt.name, stats.LogMatches, tt.want)
+		}
+	}
+}
+
+func TestLowest(t *testing.T) {
+	low := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name      string
+		index     int
+		current   float64
+		recordMin *float64
+		recordAvg float64
+		want      float64
+	}{
+		{name: "first record uses its low", index: 0, current: 0, recordMin: low(5), recordAvg: 20, want: 5},
+		{name: "first record without a low uses its average", index: 0, current: 0, recordAvg: 20, want: 20},
+		{name: "zero low is kept", index: 0, current: 0, recordMin: low(0), recordAvg: 20, want: 0},
+		{name: "lower than current", index: 2, current: 10, recordMin: low(5), recordAvg: 20, want: 5},
+		{name: "higher than current", index: 2, current: 10, recordMin: low(15), recordAvg: 20, want: 10},
+		{name: "without a low uses the average", index: 2, current: 30, recordAvg: 20, want: 20},
+		{name: "zero low replaces current", index: 1, current: 10, recordMin: low(0), recordAvg: 20, want: 0},
+	}
+	for _, tt := range tests {
+		if got := lowest(tt.index, tt.current, tt.recordMin, tt.recordAvg); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAverageSystemStatsLows(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		wantCpu float64
+		wantMem float64
+	}{
+		{
+			name:    "lowest of the records",
+			records: []string{`{"cpu":20,"cpun":5,"mu":4,"mun":3}`, `{"cpu":30,"cpun":8,"mu":6,"mun":2}`},
+			wantCpu: 5,
+			wantMem: 2,
+		},
+		{
+			name:    "zero lows are kept",
+			records: []string{`{"cpu":20,"cpun":0,"mu":4,"mun":0}`, `{"cpu":30,"cpun":8,"mu":6,"mun":5}`},
+			wantCpu: 0,
+			wantMem: 0,
+		},
+		{
+			name:    "records from older agents use the average",
+			records: []string{`{"cpu":20,"mu":4}`, `{"cpu":30,"cpun":25,"mu":6,"mun":5}`},
+			wantCpu: 20,
+			wantMem: 4,
+		},
+	}
+	rm := &RecordManager{}
+	for _, tt := range tests {
+		stats := rm.AverageSystemStats(testRecordStats(tt.records...))
+		if stats.MinCpu != tt.wantCpu || stats.MinMemUsed != tt.wantMem {
+			t.Errorf("%s: got cpu %v mem %v, want %v %v", tt.name, stats.MinCpu, stats.MinMemUsed, tt.wantCpu, tt.wantMem)
+		}
+	}
+}
+
+// Returns records with the json stats
+func testRecordStats(stats ...string) RecordStats {
+	records := make(RecordStats, len(stats))
+	for i := range stats {
+		records[i].Stats = []byte(stats[i])
+	}
+	return records
+}
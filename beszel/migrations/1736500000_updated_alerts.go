@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("elngm8x1l60zi2v")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"hidden": false,
+			"id": "zj3ingrv",
+			"maxSelect": 1,
+			"name": "name",
+			"presentable": false,
+			"required": true,
+			"system": false,
+			"type": "select",
+			"values": [
+				"Status",
+				"CPU",
+				"Memory",
+				"Disk",
+				"Temperature",
+				"Bandwidth",
+				"Service",
+				"Certificate",
+				"Custom",
+				"Log"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("elngm8x1l60zi2v")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"hidden": false,
+			"id": "zj3ingrv",
+			"maxSelect": 1,
+			"name": "name",
+			"presentable": false,
+			"required": true,
+			"system": false,
+			"type": "select",
+			"values": [
+				"Status",
+				"CPU",
+				"Memory",
+				"Disk",
+				"Temperature",
+				"Bandwidth",
+				"Service",
+				"Certificate",
+				"Custom"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
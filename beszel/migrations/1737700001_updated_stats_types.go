@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// system_stats, container_stats, check_stats and vm_stats
+var statsCollectionIds = []string{"ej9oowivz8b2mht", "juohu4jipgc13v7", "pbc_1864144027", "pbc_3107318556"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// add the 10s record type for systems polled more than once a minute
+		for _, id := range statsCollectionIds {
+			collection, err := app.FindCollectionByNameOrId(id)
+			if err != nil {
+				return err
+			}
+			field, ok := collection.Fields.GetByName("type").(*core.SelectField)
+			if !ok || slices.Contains(field.Values, "10s") {
+				continue
+			}
+			field.Values = append([]string{"10s"}, field.Values...)
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, id := range statsCollectionIds {
+			collection, err := app.FindCollectionByNameOrId(id)
+			if err != nil {
+				return err
+			}
+			if _, err := app.DB().NewQuery("DELETE FROM {{" + collection.Name + "}} WHERE [[type]] = '10s'").Execute(); err != nil {
+				return err
+			}
+			field, ok := collection.Fields.GetByName("type").(*core.SelectField)
+			if !ok {
+				continue
+			}
+			field.Values = slices.DeleteFunc(field.Values, func(value string) bool { return value == "10s" })
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
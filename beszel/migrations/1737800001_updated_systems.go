@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+
+		// hide the agent token, which is read through /api/beszel/agent-token instead
+		if field := collection.Fields.GetByName("token"); field != nil {
+			field.SetHidden(true)
+		}
+
+		// tokens identify systems when agents connect to the hub
+		collection.AddIndex("idx_systems_token", true, "`token`", "`token` != ''")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+
+		if field := collection.Fields.GetByName("token"); field != nil {
+			field.SetHidden(false)
+		}
+		collection.RemoveIndex("idx_systems_token")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2405717498")
+		if err != nil {
+			return err
+		}
+
+		// the hub connects to the endpoints of hub checks, so only admins can add them
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id && @request.auth.role = \"admin\"")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2405717498")
+		if err != nil {
+			return err
+		}
+
+		collection.CreateRule = types.Pointer("@request.auth.id != \"\" && system.users.id ?= @request.auth.id && @request.auth.role != \"readonly\"")
+
+		return app.Save(collection)
+	})
+}
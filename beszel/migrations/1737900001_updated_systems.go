@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+
+		// agent time up to which sessions were checked for new logins, kept
+		// separately from updated, which also changes when the system is edited
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": true,
+			"id": "date2740451734",
+			"max": "",
+			"min": "",
+			"name": "sessions_checked",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("2hz5ncl8tizk5nx")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("date2740451734")
+
+		return app.Save(collection)
+	})
+}